@@ -0,0 +1,108 @@
+package main
+
+import (
+	"archive/zip"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+// An archivedFile is a file inside a mod's downloaded file, as it should look once
+// installed.
+type archivedFile struct {
+	// name is the file's slash-separated path relative to the mod's install directory.
+	name  string
+	size  int64
+	crc32 uint32
+	open  func() (io.ReadCloser, error)
+}
+
+// archivedFiles lists the files that make up a mod's downloaded file.
+func archivedFiles(file *modFile, mod *modlinks.Mod) ([]archivedFile, error) {
+	if !file.IsZIP {
+		crc := crc32.NewIEEE()
+		if _, err := io.Copy(crc, io.NewSectionReader(file, 0, file.Size)); err != nil {
+			return nil, err
+		}
+		return []archivedFile{{
+			name:  cleanZipPath(path.Base(mod.Link)),
+			size:  file.Size,
+			crc32: crc.Sum32(),
+			open: func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(file, 0, file.Size)), nil
+			},
+		}}, nil
+	}
+	archive, err := zip.NewReader(file, file.Size)
+	if err != nil {
+		return nil, err
+	}
+	var files []archivedFile
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		files = append(files, archivedFile{
+			name:  cleanZipPath(f.Name),
+			size:  int64(f.UncompressedSize64),
+			crc32: f.CRC32,
+			open:  f.Open,
+		})
+	}
+	return files, nil
+}
+
+// matches reports whether the file at name has the same contents as af.
+func (af archivedFile) matches(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() != af.size {
+		return false, nil
+	}
+	crc := crc32.NewIEEE()
+	if _, err := io.Copy(crc, f); err != nil {
+		return false, err
+	}
+	return crc.Sum32() == af.crc32, nil
+}
+
+// restore writes af's contents to the file at name.
+func (af archivedFile) restore(name string) error {
+	r, err := af.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+		return err
+	}
+	w, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// archivedNames returns the names of each of files.
+func archivedNames(files []archivedFile) []string {
+	names := make([]string, len(files))
+	for i, af := range files {
+		names[i] = af.name
+	}
+	return names
+}
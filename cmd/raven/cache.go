@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dpinela/Raven/internal/config"
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+// downloadCacheDir returns the directory in which downloads are cached.
+func downloadCacheDir(cachedir string) string {
+	return filepath.Join(cachedir, appDirName, "sha256")
+}
+
+// cacheKey returns the name of the cache entry for a mod's file. mod.SHA256 must have been
+// checked to be a valid hex string.
+func cacheKey(mod *modlinks.Mod) string {
+	return strings.ToLower(mod.SHA256) + path.Ext(mod.Link)
+}
+
+// migrateLegacyCacheEntry moves a mod's file from where older versions of Raven cached it,
+// named after the mod, to its place in the current cache, if it is the right version.
+func migrateLegacyCacheEntry(cachedir string, mod *modlinks.Mod, cacheEntry string) {
+	legacyEntry := legacyCacheEntry(cachedir, mod)
+	if _, err := os.Stat(cacheEntry); err == nil {
+		return
+	}
+	if hash, err := fileSHA256(legacyEntry); err != nil || !strings.EqualFold(hash, mod.SHA256) {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(cacheEntry), 0750); err != nil {
+		return
+	}
+	// If this fails, we'll just download the file again.
+	_ = os.Rename(legacyEntry, cacheEntry)
+}
+
+// legacyCacheEntry returns where older versions of Raven cached a mod's file.
+func legacyCacheEntry(cachedir string, mod *modlinks.Mod) string {
+	return filepath.Join(cachedir, appDirName, mod.Name+path.Ext(mod.Link))
+}
+
+// A cacheEntry is a file in the download cache.
+type cacheEntry struct {
+	name    string
+	path    string
+	size    int64
+	lastUse time.Time
+	partial bool
+	// legacy is true for entries left over from older versions of Raven, which were
+	// named after the mod instead of the file's hash.
+	legacy bool
+}
+
+// expectedHash returns the hash the entry's contents should have, according to its
+// name, or an empty string if this is not known.
+func (e cacheEntry) expectedHash() string {
+	if e.legacy || e.partial {
+		return ""
+	}
+	return strings.TrimSuffix(e.name, path.Ext(e.name))
+}
+
+// cacheEntries returns all of the mod downloads in the cache, including partial ones,
+// ordered from least to most recently used.
+func cacheEntries(cachedir string) ([]cacheEntry, error) {
+	entries, err := listCacheDir(downloadCacheDir(cachedir), false)
+	if err != nil {
+		return nil, err
+	}
+	legacyEntries, err := listCacheDir(filepath.Join(cachedir, appDirName), true)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, legacyEntries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].lastUse.Before(entries[j].lastUse) })
+	return entries, nil
+}
+
+func listCacheDir(dir string, legacy bool) ([]cacheEntry, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list cache entries: %w", err)
+	}
+	entries := make([]cacheEntry, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		if !de.Type().IsRegular() || strings.HasPrefix(de.Name(), lockFileName) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, cacheEntry{
+			name:    de.Name(),
+			path:    filepath.Join(dir, de.Name()),
+			size:    info.Size(),
+			lastUse: info.ModTime(),
+			partial: strings.HasSuffix(de.Name(), partialDownloadExt),
+			legacy:  legacy,
+		})
+	}
+	return entries, nil
+}
+
+// touchCacheEntry marks a cache entry as having just been used.
+func touchCacheEntry(name string) {
+	now := time.Now()
+	// This only affects which entries are evicted first, so it's not worth failing over.
+	_ = os.Chtimes(name, now, now)
+}
+
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sha := sha256.New()
+	if _, err := io.Copy(sha, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sha.Sum(nil)), nil
+}
+
+// modsByHash maps the lowercase hash of every file listed on modlinks to the names of the
+// mods or base components that use it.
+func modsByHash(repo *modlinks.Repository) map[string][]string {
+	index := map[string][]string{}
+	add := func(name string, get func(string) (modlinks.Mod, error)) {
+		mod, err := get(name)
+		if err != nil {
+			return
+		}
+		h := strings.ToLower(mod.SHA256)
+		index[h] = append(index[h], name)
+	}
+	for _, name := range repo.BaseNames() {
+		add(name, repo.GetBase)
+	}
+	for _, name := range repo.ModNames() {
+		add(name, repo.GetMod)
+	}
+	return index
+}
+
+// checkCacheEntry hashes the contents of a cache entry, and reports whether they are
+// intact; for legacy entries, whose intended contents are unknown, it always reports
+// that they are.
+func checkCacheEntry(e cacheEntry) (hash string, intact bool, err error) {
+	hash, err = fileSHA256(e.path)
+	if err != nil {
+		return "", false, err
+	}
+	expected := e.expectedHash()
+	return hash, expected == "" || strings.EqualFold(hash, expected), nil
+}
+
+func cache(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("cache: expected a subcommand: list, verify, prune or clear")
+	}
+	cachedir, err := os.UserCacheDir()
+	if err != nil {
+		return fmt.Errorf("cache directory not available: %w", err)
+	}
+	switch args[0] {
+	case "list":
+		return cacheList(ctx, cachedir)
+	case "verify":
+		return cacheVerify(ctx, cachedir)
+	case "prune", "clear":
+		release, err := acquireLocks(cacheLock(cachedir))
+		if err != nil {
+			return err
+		}
+		defer release()
+		if args[0] == "clear" {
+			return cacheClear(cachedir)
+		}
+		return cachePrune(ctx, cachedir)
+	default:
+		return fmt.Errorf("cache: unknown subcommand: %s", args[0])
+	}
+}
+
+func cacheList(ctx context.Context, cachedir string) error {
+	repo, err := getModlinks(ctx)
+	if err != nil {
+		return err
+	}
+	index := modsByHash(repo)
+	entries, err := cacheEntries(cachedir)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.size
+		if e.partial {
+			fmt.Printf("%s\t%s\tpartial download\n", e.name, dataSize(e.size))
+			continue
+		}
+		hash, intact, err := checkCacheEntry(e)
+		if err != nil {
+			fmt.Printf("%s\t%s\t%v\n", e.name, dataSize(e.size), err)
+			continue
+		}
+		status := "not on modlinks"
+		if !intact {
+			status = "corrupted"
+		} else if mods := index[hash]; len(mods) > 0 {
+			status = "current for " + strings.Join(mods, ", ")
+		}
+		fmt.Printf("%s\t%s\t%s\n", shortHash(hash)+path.Ext(e.name), dataSize(e.size), status)
+	}
+	fmt.Printf("Total: %s in %d files\n", dataSize(total), len(entries))
+	return nil
+}
+
+func cacheVerify(ctx context.Context, cachedir string) error {
+	entries, err := cacheEntries(cachedir)
+	if err != nil {
+		return err
+	}
+	bad := 0
+	for _, e := range entries {
+		if e.partial || e.legacy {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, intact, err := checkCacheEntry(e)
+		if err != nil {
+			fmt.Printf("%s: %v\n", e.name, err)
+			bad++
+			continue
+		}
+		if !intact {
+			fmt.Printf("%s: contents do not match hash\n", e.name)
+			bad++
+		}
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d cached files are corrupted; use raven cache prune to remove them", bad)
+	}
+	fmt.Println("All cached files are intact")
+	return nil
+}
+
+func cachePrune(ctx context.Context, cachedir string) error {
+	repo, err := getModlinks(ctx)
+	if err != nil {
+		return err
+	}
+	index := modsByHash(repo)
+	// Installed versions are kept even once modlinks has moved on from them, since
+	// verify and update need their archives.
+	installed := map[string]bool{}
+	if settings, err := gameSettings(); err == nil {
+		man, err := manifest.Get(settings.GameLocation)
+		if err != nil {
+			return err
+		}
+		for _, im := range man.Mods {
+			installed[strings.ToLower(im.SHA256)] = true
+		}
+	}
+	entries, err := cacheEntries(cachedir)
+	if err != nil {
+		return err
+	}
+	var freed int64
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !e.partial {
+			hash, intact, err := checkCacheEntry(e)
+			if err == nil && intact && (len(index[hash]) > 0 || installed[hash]) {
+				continue
+			}
+		}
+		if err := os.Remove(e.path); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println("Removed", e.name)
+		freed += e.size
+	}
+	fmt.Println("Freed", dataSize(freed))
+	return nil
+}
+
+func cacheClear(cachedir string) error {
+	dir := filepath.Join(cachedir, appDirName)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("clear cache: %w", err)
+	}
+	for _, e := range entries {
+		// Leave our own lock in place until we're done.
+		if strings.HasPrefix(e.Name(), lockFileName) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return fmt.Errorf("clear cache: %w", err)
+		}
+	}
+	fmt.Println("Cleared", dir)
+	return nil
+}
+
+// enforceCacheLimit evicts the least recently used entries from the cache until its total
+// size is within the configured limit, if there is one.
+func enforceCacheLimit(cachedir string) error {
+	settings, err := config.Get()
+	if err != nil || settings.CacheLimitMB <= 0 {
+		return nil
+	}
+	limit := int64(settings.CacheLimitMB) * 1_000_000
+	entries, err := cacheEntries(cachedir)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	for _, e := range entries {
+		if total <= limit {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			return fmt.Errorf("evict %s from cache: %w", e.name, err)
+		}
+		total -= e.size
+	}
+	return nil
+}
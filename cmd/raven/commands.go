@@ -1,18 +1,151 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dpinela/Raven/internal/config"
+	"github.com/dpinela/Raven/internal/httpclient"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+// globalOptions holds the options that may be given before the command name, and apply
+// to any command.
+type globalOptions struct {
+	modlinksSource string
+	// offline makes Raven work exclusively from cached downloads.
+	offline bool
+	// downloadLimit overrides the maximum number of concurrent downloads, if positive.
+	downloadLimit int
+}
+
+// options holds the global options for the command currently being run.
+var options globalOptions
+
+// httpClient is used for all downloads.
+var httpClient = httpclient.Default
+
+// errInterrupted is returned from commands that were cancelled by the user.
+var errInterrupted = errors.New("interrupted")
+
+func runCommand(ctx context.Context, args []string) error {
+	err := dispatchCommand(ctx, args)
+	if err != nil && ctx.Err() != nil {
+		return errInterrupted
+	}
+	return err
+}
+
+func dispatchCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("raven", flag.ContinueOnError)
+	options = globalOptions{}
+	flags.StringVar(&options.modlinksSource, "modlinks", "", "Get modlinks from `source` (a URL, ZIP file or directory)")
+	flags.BoolVar(&options.offline, "offline", false, "Use only cached copies of modlinks and mods; never download anything")
+	flags.IntVar(&options.downloadLimit, "j", 0, "Download up to `n` mods at once")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		return errors.New("no command given")
+	}
+	client, err := newHTTPClient()
+	if err != nil {
+		return err
+	}
+	httpClient = client
 
-func runCommand(args []string) error {
 	switch (args[0]) {
 	case "setup":
-		return setup(args[1:])
+		return setup(ctx, args[1:])
 	case "install":
-		return install(args[1:])
+		return install(ctx, args[1:])
 	case "list":
-		return list(args[1:])
+		return list(ctx, args[1:])
 	case "yeet":
-		return yeet(args[1:])
+		return yeet(ctx, args[1:])
+	case "update":
+		return update(ctx, args[1:])
+	case "outdated":
+		return outdated(ctx, args[1:])
+	case "disable":
+		return disable(ctx, args[1:])
+	case "enable":
+		return enable(ctx, args[1:])
+	case "profile":
+		return profile(ctx, args[1:])
+	case "export":
+		return export(ctx, args[1:])
+	case "import":
+		return importPack(ctx, args[1:])
+	case "cache":
+		return cache(ctx, args[1:])
+	case "verify":
+		return verify(ctx, args[1:])
+	case "autoremove":
+		return autoremove(ctx, args[1:])
+	case "rdeps":
+		return rdeps(ctx, args[1:])
+	case "why":
+		return why(ctx, args[1:])
 	default:
 		return fmt.Errorf("unknown command: %s", args[0])
 	}
 }
+
+// getModlinks loads modlinks from the source given on the command line, or failing that,
+// the one in the settings, or failing that, the default one.
+func getModlinks(ctx context.Context) (*modlinks.Repository, error) {
+	return loadModlinks(ctx, false)
+}
+
+// loadModlinks is like getModlinks, but if readOnly is true, it leaves the modlinks cache
+// and the global options alone, as dry runs must.
+func loadModlinks(ctx context.Context, readOnly bool) (*modlinks.Repository, error) {
+	source := options.modlinksSource
+	if source == "" {
+		// Setup may not have been done yet, in which case we just use the default.
+		settings, _ := config.Get()
+		source = settings.ModlinksSource
+	}
+	opts := modlinks.Options{Source: source, Offline: options.offline, ReadOnly: readOnly, Client: httpClient}
+	// Without a cache directory, we can still work; it'll just be slower.
+	if cachedir, err := os.UserCacheDir(); err == nil {
+		opts.CacheDir = filepath.Join(cachedir, appDirName, "modlinks")
+	}
+	repo, err := modlinks.Get(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.FetchError(); err != nil {
+		fmt.Println("warning:", err)
+		if readOnly {
+			fmt.Println("warning: using the cached copy of modlinks")
+			return repo, nil
+		}
+		fmt.Println("warning: working offline from cached downloads")
+		// If we couldn't get modlinks, we're probably not going to be able to download
+		// anything else either, so don't waste time trying.
+		options.offline = true
+	}
+	return repo, nil
+}
+
+// newHTTPClient returns a client configured according to the settings.
+func newHTTPClient() (*httpclient.Client, error) {
+	// Setup may not have been done yet, in which case we just use the defaults.
+	settings, _ := config.Get()
+	opts := httpclient.Options{
+		UserAgent: "Raven/" + version + " (+https://github.com/dpinela/Raven)",
+		Proxy:     settings.Proxy,
+		Retry:     httpclient.DefaultRetryPolicy,
+	}
+	if settings.RetryAttempts > 0 {
+		opts.Retry.MaxAttempts = settings.RetryAttempts
+	}
+	return httpclient.New(opts)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dpinela/Raven/internal/manifest"
+)
+
+// A fileConflict is a file that more than one mod provides.
+type fileConflict struct {
+	file string
+	mods []string
+	// paths are the conflicting files, relative to the plugins directory; that is, each
+	// one starts with the name of the mod it's in.
+	paths []string
+}
+
+func (c fileConflict) String() string {
+	return fmt.Sprintf("%s is in %s", c.file, strings.Join(c.paths, ", "))
+}
+
+// findConflicts returns the files that more than one mod would provide if the mods in
+// incoming, which maps mod names to the files they contain, were installed alongside the
+// other enabled mods in modsdir. Mods that are currently disabled, and so would be
+// installed disabled, are left out, since the game doesn't load them.
+//
+// Since every mod has its own directory, mods can't overwrite each other's files; but
+// the game loads assemblies by name, so two mods with a DLL of the same name will break
+// at least one of them.
+func findConflicts(modsdir string, man manifest.Manifest, incoming map[string][]string) ([]fileConflict, error) {
+	owners := map[string][]string{}
+	paths := map[string][]string{}
+	names := map[string]string{}
+	add := func(mod string, files []string) {
+		for _, f := range files {
+			base := path.Base(f)
+			if !strings.EqualFold(path.Ext(base), ".dll") {
+				continue
+			}
+			key := strings.ToLower(base)
+			if _, ok := names[key]; !ok {
+				names[key] = base
+			}
+			if !slices.Contains(owners[key], mod) {
+				owners[key] = append(owners[key], mod)
+			}
+			paths[key] = append(paths[key], mod+"/"+f)
+		}
+	}
+	enabled, err := installedMods(modsdir)
+	if err != nil {
+		return nil, err
+	}
+	for _, mod := range enabled {
+		if _, ok := incoming[mod]; ok {
+			// This mod is being replaced.
+			continue
+		}
+		files, err := ownedFiles(modsdir, man, mod)
+		if err != nil {
+			return nil, err
+		}
+		add(mod, files)
+	}
+	for mod, files := range incoming {
+		if modDir(modsdir, mod) != filepath.Join(modsdir, mod) {
+			continue
+		}
+		add(mod, files)
+	}
+
+	var conflicts []fileConflict
+	for key, mods := range owners {
+		if len(mods) > 1 {
+			sort.Strings(mods)
+			sort.Strings(paths[key])
+			conflicts = append(conflicts, fileConflict{file: names[key], mods: mods, paths: paths[key]})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].file < conflicts[j].file })
+	return conflicts, nil
+}
+
+// ownedFiles returns the files belonging to an installed mod: those recorded in the
+// manifest, or, for mods that Raven didn't install, whatever is in its directory.
+func ownedFiles(modsdir string, man manifest.Manifest, mod string) ([]string, error) {
+	if im, ok := man.Mods[mod]; ok {
+		return im.Files, nil
+	}
+	files, err := dirFiles(modDir(modsdir, mod))
+	if err != nil {
+		return nil, fmt.Errorf("list files of %s: %w", mod, err)
+	}
+	return files, nil
+}
+
+// dirFiles returns the slash-separated paths, relative to dir, of all the files inside it.
+func dirFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
+
+type conflictsError []fileConflict
+
+func (err conflictsError) Error() string {
+	var b strings.Builder
+	b.WriteString("mods conflict with each other:")
+	for _, c := range err {
+		fmt.Fprintf(&b, "\n\t%s", c)
+	}
+	b.WriteString("\nuse -force to install anyway")
+	return b.String()
+}
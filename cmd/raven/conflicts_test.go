@@ -0,0 +1,53 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/dpinela/Raven/internal/manifest"
+)
+
+func TestFindConflicts(t *testing.T) {
+	game := t.TempDir()
+	plugins := pluginsDir(game)
+	writeTestFile(t, filepath.Join(plugins, "Managed", "Managed.dll"), "managed")
+	writeTestFile(t, filepath.Join(plugins, "Unmanaged", "lib", "Shared.DLL"), "unmanaged")
+	writeTestFile(t, filepath.Join(plugins, "Replaced", "Old.dll"), "old")
+	writeTestFile(t, filepath.Join(plugins, disabledDirName, "Sleeping", "Managed.dll"), "disabled")
+	man := manifest.Manifest{Mods: map[string]manifest.Mod{
+		"Managed":  {Files: []string{"Managed.dll", "README.md"}},
+		"Replaced": {Files: []string{"Old.dll"}},
+	}}
+	incoming := map[string][]string{
+		"Replaced": {"Old.dll"},
+		"New":      {"shared.dll", "Managed.dll", "README.md"},
+		// This mod is disabled, so it stays that way once reinstalled, and can't conflict.
+		"Sleeping": {"Managed.dll"},
+	}
+	conflicts, err := findConflicts(plugins, man, incoming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fileConflict{
+		{file: "Managed.dll", mods: []string{"Managed", "New"}, paths: []string{"Managed/Managed.dll", "New/Managed.dll"}},
+		{file: "Shared.DLL", mods: []string{"New", "Unmanaged"}, paths: []string{"New/shared.dll", "Unmanaged/lib/Shared.DLL"}},
+	}
+	if !slices.EqualFunc(conflicts, want, func(a, b fileConflict) bool {
+		return a.file == b.file && slices.Equal(a.mods, b.mods) && slices.Equal(a.paths, b.paths)
+	}) {
+		t.Errorf("got conflicts %v, want %v", conflicts, want)
+	}
+}
+
+func TestFindConflictsWithoutPluginsDir(t *testing.T) {
+	plugins := pluginsDir(t.TempDir())
+	man := manifest.Manifest{Mods: map[string]manifest.Mod{}}
+	conflicts, err := findConflicts(plugins, man, map[string][]string{"New": {"New.dll"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("got conflicts %v on a fresh game", conflicts)
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
 	"unicode"
 )
@@ -25,7 +27,11 @@ func runConsole() error {
 		if cmdLine[0] == "exit" {
 			break
 		}
-		if err := runCommand(cmdLine); err != nil {
+		// Ctrl-C only interrupts the current command, not the whole console.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := runCommand(ctx, cmdLine)
+		stop()
+		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 		}
 	}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+// directDependents maps the name of every mod that some of the installed mods depend on,
+// according to modlinks, to the names of those installed mods.
+func directDependents(repo *modlinks.Repository, installed []string) map[string][]string {
+	dependents := map[string][]string{}
+	for _, name := range installed {
+		mod, err := repo.GetMod(name)
+		if err != nil {
+			continue
+		}
+		for _, dep := range mod.Dependencies {
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+	for _, names := range dependents {
+		sort.Strings(names)
+	}
+	return dependents
+}
+
+// installedDependents returns the installed mods that depend on the named one, split into
+// those that list it as a dependency themselves, and those that only depend on it
+// through other mods.
+func installedDependents(repo *modlinks.Repository, installed []string, name string) (direct, indirect []string) {
+	dependents := directDependents(repo, installed)
+	direct = dependents[name]
+	seen := map[string]bool{name: true}
+	for _, d := range direct {
+		seen[d] = true
+	}
+	queue := append([]string(nil), direct...)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, d := range dependents[next] {
+			if !seen[d] {
+				seen[d] = true
+				indirect = append(indirect, d)
+				queue = append(queue, d)
+			}
+		}
+	}
+	sort.Strings(indirect)
+	return direct, indirect
+}
+
+// orphanedMods returns those of the installed mods that were only installed as
+// dependencies of other mods, and that are not needed by any of the others anymore.
+// Mods that were installed explicitly, or by something other than Raven, are never
+// orphaned.
+func orphanedMods(repo *modlinks.Repository, man manifest.Manifest, installed []string) []string {
+	var roots []string
+	for _, name := range installed {
+		if im, ok := man.Mods[name]; !ok || im.Explicit {
+			roots = append(roots, name)
+		}
+	}
+	// Roots that aren't on modlinks are reported as missing, but we can't do anything
+	// about their dependencies anyway.
+	closure, _ := repo.TransitiveClosure(roots)
+	needed := make(map[string]bool, len(closure))
+	for _, mod := range closure {
+		needed[mod.Name] = true
+	}
+	var orphans []string
+	for _, name := range installed {
+		if im, ok := man.Mods[name]; ok && !im.Explicit && !needed[name] {
+			orphans = append(orphans, name)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// warnDependents prints a warning for each of the remaining installed mods that depends
+// on a mod that is being removed.
+func warnDependents(repo *modlinks.Repository, remaining []string, removed map[string]bool) {
+	dependents := directDependents(repo, remaining)
+	names := make([]string, 0, len(removed))
+	for name := range removed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if deps := dependents[name]; len(deps) > 0 {
+			fmt.Printf("warning: %s is needed by %s\n", name, strings.Join(deps, ", "))
+		}
+	}
+}
+
+// without returns the elements of xs that are not in set.
+func without(xs []string, set map[string]bool) []string {
+	rest := make([]string, 0, len(xs))
+	for _, x := range xs {
+		if !set[x] {
+			rest = append(rest, x)
+		}
+	}
+	return rest
+}
+
+func autoremove(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("autoremove", flag.ContinueOnError)
+	var dryRun bool
+	flags.BoolVar(&dryRun, "dry-run", false, "Show what would be deleted, without deleting anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	settings, err := gameSettings()
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		release, err := acquireLocks(gameLock(settings.GameLocation))
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	repo, err := loadModlinks(ctx, dryRun)
+	if err != nil {
+		return err
+	}
+	man, err := manifest.Get(settings.GameLocation)
+	if err != nil {
+		return err
+	}
+	modsdir := pluginsDir(settings.GameLocation)
+	installed, err := allInstalledMods(modsdir)
+	if err != nil {
+		return err
+	}
+	orphans := orphanedMods(repo, man, installed)
+	if len(orphans) == 0 {
+		fmt.Println("No mods to remove")
+		return nil
+	}
+	return yeetMods(settings.GameLocation, man, stringSet(orphans), dryRun)
+}
+
+func rdeps(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("rdeps: expected the name of an installed mod")
+	}
+	settings, err := gameSettings()
+	if err != nil {
+		return err
+	}
+	repo, err := getModlinks(ctx)
+	if err != nil {
+		return err
+	}
+	installed, err := allInstalledMods(pluginsDir(settings.GameLocation))
+	if err != nil {
+		return err
+	}
+	name, err := modlinks.ResolveModName(installed, args[0])
+	if err != nil {
+		return err
+	}
+	direct, indirect := installedDependents(repo, installed, name)
+	if len(direct) == 0 {
+		fmt.Println("No installed mods need", name)
+		return nil
+	}
+	printModSummary("Needed directly by", direct)
+	printModSummary("Needed indirectly by", indirect)
+	return nil
+}
+
+// dependencyChains returns every chain of dependencies leading from one of roots down to
+// the named mod, given a map from each mod to the mods that depend on it. Each chain
+// starts with a root and ends with name.
+func dependencyChains(parents map[string][]string, roots map[string]bool, name string) [][]string {
+	var chains [][]string
+	onPath := map[string]bool{}
+	var walk func(path []string)
+	walk = func(path []string) {
+		mod := path[len(path)-1]
+		if roots[mod] {
+			chain := slices.Clone(path)
+			slices.Reverse(chain)
+			chains = append(chains, chain)
+		}
+		onPath[mod] = true
+		ps := slices.Clone(parents[mod])
+		sort.Strings(ps)
+		for _, p := range ps {
+			if !onPath[p] {
+				walk(append(path, p))
+			}
+		}
+		onPath[mod] = false
+	}
+	walk([]string{name})
+	return chains
+}
+
+func why(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("why: expected the name of a mod")
+	}
+	repo, err := getModlinks(ctx)
+	if err != nil {
+		return err
+	}
+	var roots []string
+	if len(args) > 1 {
+		// Explain what installing these mods would do.
+		for _, arg := range args[1:] {
+			name, err := repo.ResolveModName(arg)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			roots = append(roots, name)
+		}
+	} else {
+		settings, err := gameSettings()
+		if err != nil {
+			return err
+		}
+		man, err := manifest.Get(settings.GameLocation)
+		if err != nil {
+			return err
+		}
+		installed, err := allInstalledMods(pluginsDir(settings.GameLocation))
+		if err != nil {
+			return err
+		}
+		for _, name := range installed {
+			if im, ok := man.Mods[name]; !ok || im.Explicit {
+				roots = append(roots, name)
+			}
+		}
+	}
+
+	closure, parents, _ := repo.TransitiveClosureWithParents(roots)
+	names := make([]string, len(closure))
+	for i, mod := range closure {
+		names[i] = mod.Name
+	}
+	name, err := modlinks.ResolveModName(names, args[0])
+	if err != nil {
+		return fmt.Errorf("why: %w among the requested mods and their dependencies", err)
+	}
+	for _, chain := range dependencyChains(parents, stringSet(roots), name) {
+		if len(chain) == 1 {
+			fmt.Println(name, "(requested explicitly)")
+		} else {
+			fmt.Println(strings.Join(chain, " -> "))
+		}
+	}
+	return nil
+}
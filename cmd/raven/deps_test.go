@@ -0,0 +1,75 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+func testRepository(t *testing.T) *modlinks.Repository {
+	t.Helper()
+	mod := func(name, deps string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte("Name = \"" + name + "\"\nDependencies = [" + deps + "]\n")}
+	}
+	repo, err := modlinks.FromFS(fstest.MapFS{
+		"mods/ItemChanger.toml": mod("ItemChanger", ""),
+		"mods/MagicUI.toml":     mod("MagicUI", ""),
+		"mods/Plando.toml":      mod("Plando", `"ItemChanger", "MagicUI"`),
+		"mods/Randemo.toml":     mod("Randemo", `"Plando"`),
+		"mods/Speedrun.toml":    mod("Speedrun", `"MagicUI"`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestOrphanedMods(t *testing.T) {
+	repo := testRepository(t)
+	man := manifest.Manifest{Mods: map[string]manifest.Mod{
+		"ItemChanger": {},
+		"MagicUI":     {},
+		"Plando":      {},
+		"Speedrun":    {Explicit: true},
+	}}
+	// Randemo is gone, and nothing else needs Plando or ItemChanger anymore; MagicUI is
+	// still needed by Speedrun.
+	got := orphanedMods(repo, man, []string{"ItemChanger", "MagicUI", "Plando", "Speedrun"})
+	want := []string{"ItemChanger", "Plando"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got orphans %v, want %v", got, want)
+	}
+}
+
+func TestInstalledDependents(t *testing.T) {
+	repo := testRepository(t)
+	installed := []string{"ItemChanger", "MagicUI", "Plando", "Randemo", "Speedrun"}
+	direct, indirect := installedDependents(repo, installed, "MagicUI")
+	if want := []string{"Plando", "Speedrun"}; !slices.Equal(direct, want) {
+		t.Errorf("got direct dependents %v, want %v", direct, want)
+	}
+	if want := []string{"Randemo"}; !slices.Equal(indirect, want) {
+		t.Errorf("got indirect dependents %v, want %v", indirect, want)
+	}
+}
+
+func TestDependencyChains(t *testing.T) {
+	repo := testRepository(t)
+	roots := []string{"Randemo", "Speedrun", "Plando"}
+	_, parents, err := repo.TransitiveClosureWithParents(roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := dependencyChains(parents, stringSet(roots), "MagicUI")
+	want := [][]string{
+		{"Plando", "MagicUI"},
+		{"Randemo", "Plando", "MagicUI"},
+		{"Speedrun", "MagicUI"},
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("got chains %v, want %v", got, want)
+	}
+}
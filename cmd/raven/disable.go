@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+// Mods moved into this subdirectory of the plugins directory are not loaded by the game.
+const disabledDirName = "Disabled"
+
+// disabledDir returns the path to the directory holding disabled mods, using the
+// spelling of the existing directory if there is one.
+func disabledDir(modsdir string) string {
+	entries, _ := os.ReadDir(modsdir)
+	for _, e := range entries {
+		if e.IsDir() && isDisabledDirName(e.Name()) {
+			return filepath.Join(modsdir, e.Name())
+		}
+	}
+	return filepath.Join(modsdir, disabledDirName)
+}
+
+func isDisabledDirName(name string) bool {
+	return strings.EqualFold(strings.TrimSpace(name), disabledDirName)
+}
+
+// disabledMods returns the names of all of the mods in the Disabled directory.
+func disabledMods(modsdir string) ([]string, error) {
+	entries, err := os.ReadDir(disabledDir(modsdir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list disabled mods: %w", err)
+	}
+	modnames := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			modnames = append(modnames, e.Name())
+		}
+	}
+	return modnames, nil
+}
+
+// allInstalledMods returns the names of all installed mods, whether enabled or disabled.
+func allInstalledMods(modsdir string) ([]string, error) {
+	enabled, err := installedMods(modsdir)
+	if err != nil {
+		return nil, err
+	}
+	disabled, err := disabledMods(modsdir)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(enabled))
+	for _, name := range enabled {
+		seen[name] = true
+	}
+	all := enabled
+	for _, name := range disabled {
+		if !seen[name] {
+			all = append(all, name)
+		}
+	}
+	return all, nil
+}
+
+// modDir returns the directory where the named mod is, or should be, installed:
+// inside the Disabled directory if the mod is currently disabled, or directly
+// inside modsdir otherwise.
+func modDir(modsdir, name string) string {
+	enabledDir := filepath.Join(modsdir, name)
+	if _, err := os.Stat(enabledDir); err == nil {
+		return enabledDir
+	}
+	d := filepath.Join(disabledDir(modsdir), name)
+	if _, err := os.Stat(d); err == nil {
+		return d
+	}
+	return enabledDir
+}
+
+func disable(ctx context.Context, args []string) error {
+	settings, err := gameSettings()
+	if err != nil {
+		return err
+	}
+	release, err := acquireLocks(gameLock(settings.GameLocation))
+	if err != nil {
+		return err
+	}
+	defer release()
+	modsdir := pluginsDir(settings.GameLocation)
+	enabled, err := installedMods(modsdir)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		name, err := modlinks.ResolveModName(enabled, arg)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if err := disableMod(modsdir, name); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println("Disabled", name)
+	}
+	return nil
+}
+
+func disableMod(modsdir, name string) error {
+	ddir := disabledDir(modsdir)
+	if err := os.MkdirAll(ddir, 0750); err != nil {
+		return fmt.Errorf("disable %s: %w", name, err)
+	}
+	return moveMod(name, filepath.Join(modsdir, name), filepath.Join(ddir, name))
+}
+
+func enable(ctx context.Context, args []string) error {
+	settings, err := gameSettings()
+	if err != nil {
+		return err
+	}
+	release, err := acquireLocks(gameLock(settings.GameLocation))
+	if err != nil {
+		return err
+	}
+	defer release()
+	modsdir := pluginsDir(settings.GameLocation)
+	disabled, err := disabledMods(modsdir)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		name, err := modlinks.ResolveModName(disabled, arg)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if err := enableMod(modsdir, name); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println("Enabled", name)
+	}
+	return nil
+}
+
+func enableMod(modsdir, name string) error {
+	return moveMod(name, filepath.Join(disabledDir(modsdir), name), filepath.Join(modsdir, name))
+}
+
+func moveMod(name, from, to string) error {
+	if _, err := os.Stat(to); err == nil {
+		return fmt.Errorf("cannot move %s: %s already exists", name, to)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("move %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dpinela/Raven/internal/config"
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+// lookupCachedFile returns the cached file for a mod, or nil if there is no valid copy of
+// it in the cache. Unlike getModFile, it never changes anything in the cache.
+func lookupCachedFile(cachedir string, mod *modlinks.Mod) *modFile {
+	candidates := []string{
+		filepath.Join(downloadCacheDir(cachedir), cacheKey(mod)),
+		legacyCacheEntry(cachedir, mod),
+	}
+	for _, name := range candidates {
+		if hash, err := fileSHA256(name); err != nil || !strings.EqualFold(hash, mod.SHA256) {
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			continue
+		}
+		return &modFile{File: f, Size: info.Size(), IsZIP: path.Ext(mod.Link) == ".zip"}
+	}
+	return nil
+}
+
+// downloadSize asks the server how big the file at url is, and reports whether it could
+// find out.
+func downloadSize(ctx context.Context, url string) (int64, bool) {
+	if options.offline {
+		return 0, false
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0, false
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	resp.Body.Close()
+	if !isHTTPOK(resp.StatusCode) || resp.ContentLength < 0 {
+		return 0, false
+	}
+	return resp.ContentLength, true
+}
+
+// printInstallPlan describes what installMods would do with the same arguments, without
+// doing any of it: which mods would be downloaded, which files would be extracted, and
+// which installed mods would be replaced.
+func printInstallPlan(ctx context.Context, gameLocation, cachedir string, man manifest.Manifest, mods []modlinks.Mod) error {
+	modsdir := pluginsDir(gameLocation)
+	installed, err := allInstalledMods(modsdir)
+	if err != nil {
+		return err
+	}
+	isInstalled := stringSet(installed)
+	// As in installMods, settings only affect which files are preserved.
+	settings, _ := config.Get()
+
+	mods = slices.Clone(mods)
+	slices.SortFunc(mods, func(a, b modlinks.Mod) int { return strings.Compare(a.Name, b.Name) })
+	incoming := make(map[string][]string, len(mods))
+	allKnown := true
+	for _, mod := range mods {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file := lookupCachedFile(cachedir, &mod)
+		if file == nil {
+			if options.offline {
+				fmt.Printf("Cannot install %s: %v\n", mod.Name, errNotCached)
+				allKnown = false
+				continue
+			}
+			if size, ok := downloadSize(ctx, mod.Link); ok {
+				fmt.Printf("Would download %s from %s (%s)\n", mod.Name, mod.Link, dataSize(size))
+			} else {
+				fmt.Printf("Would download %s from %s\n", mod.Name, mod.Link)
+			}
+		}
+
+		var archived []archivedFile
+		var files []string
+		switch {
+		case file != nil:
+			archived, err = archivedFiles(file, &mod)
+			file.Close()
+			if err != nil {
+				return err
+			}
+			files = archivedNames(archived)
+		case path.Ext(mod.Link) != ".zip":
+			files = []string{cleanZipPath(path.Base(mod.Link))}
+		}
+
+		if !isInstalled[mod.Name] {
+			fmt.Printf("Would install %s %s\n", mod.Name, shortHash(mod.SHA256))
+		} else {
+			var previous *manifest.Mod
+			version := "(unknown version)"
+			if im, ok := man.Mods[mod.Name]; ok {
+				previous = &im
+				version = shortHash(im.SHA256)
+			}
+			fmt.Printf("Would replace %s %s with %s\n", mod.Name, version, shortHash(mod.SHA256))
+			// Without the archive, files the user added can't be checked against the
+			// new version's, so the plan may keep some that the install will replace.
+			kept, err := userFiles(cachedir, modDir(modsdir, mod.Name), previous, archived, settings.PreservePatterns(mod.Name))
+			if err != nil {
+				return err
+			}
+			if err := printModDeletion(modsdir, mod.Name, kept); err != nil {
+				return err
+			}
+		}
+
+		if files == nil {
+			allKnown = false
+			fmt.Println("\textract (contents unknown until downloaded)")
+			continue
+		}
+		for _, f := range files {
+			fmt.Println("\textract", f)
+		}
+		incoming[mod.Name] = files
+	}
+
+	conflicts, err := findConflicts(modsdir, man, incoming)
+	if err != nil {
+		return err
+	}
+	for _, c := range conflicts {
+		fmt.Println("Conflict:", c)
+	}
+	if !allKnown {
+		fmt.Println("Conflicts with mods that haven't been downloaded yet cannot be checked")
+	}
+	return nil
+}
+
+// printModDeletion lists the files that removing an installed mod would delete, other
+// than those in kept, which are listed as being kept instead.
+func printModDeletion(modsdir, name string, kept []string) error {
+	files, err := dirFiles(modDir(modsdir, name))
+	if err != nil {
+		return fmt.Errorf("list files of %s: %w", name, err)
+	}
+	isKept := stringSet(kept)
+	for _, f := range files {
+		if isKept[f] {
+			fmt.Println("\tkeep", f)
+		} else {
+			fmt.Println("\tdelete", f)
+		}
+	}
+	return nil
+}
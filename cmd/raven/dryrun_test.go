@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+func TestPrintInstallPlanOnFreshGame(t *testing.T) {
+	cachedir := t.TempDir()
+	mod := writeTestArchive(t, cachedir, "Plando", map[string]string{"Plando.dll": "plando"})
+	// Setup doesn't create the plugins directory, so a game with no mods doesn't have one.
+	game := t.TempDir()
+	if err := printInstallPlan(context.Background(), game, cachedir, manifest.Manifest{}, []modlinks.Mod{mod}); err != nil {
+		t.Fatal(err)
+	}
+}
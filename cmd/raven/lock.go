@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/dpinela/Raven/internal/lockfile"
+)
+
+const lockFileName = "raven.lock"
+
+// gameLock returns the path to the lock file guarding the game at gameLocation.
+func gameLock(gameLocation string) string {
+	return filepath.Join(gameLocation, "BepInEx", lockFileName)
+}
+
+// cacheLock returns the path to the lock file guarding the download cache.
+func cacheLock(cachedir string) string {
+	return filepath.Join(cachedir, appDirName, lockFileName)
+}
+
+// acquireLocks takes each of the given locks, so that no other instance of Raven can
+// change what they guard until the returned function is called to release them. If any
+// of them is already held, it releases the ones it took and returns an error.
+func acquireLocks(paths ...string) (release func(), err error) {
+	locks := make([]*lockfile.Lock, 0, len(paths))
+	release = func() {
+		for _, l := range locks {
+			if err := l.Release(); err != nil {
+				fmt.Println("warning: release lock:", err)
+			}
+		}
+	}
+	for _, p := range paths {
+		l, err := lockfile.Acquire(p)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return release, nil
+}
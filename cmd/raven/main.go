@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 )
 
+// version is reported to servers Raven downloads from. Release builds set it with
+// -ldflags "-X main.version=...", as dist.sh does.
+var version = "dev"
+
 func main() {
 	var err error
 	if len(os.Args) > 1 {
-		err = runCommand(os.Args[1:])
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = runCommand(ctx, os.Args[1:])
+		stop()
 	} else {
 		err = runConsole()
 	}
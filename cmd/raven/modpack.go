@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+// A modpack is a shareable description of a set of mods, pinned to specific versions.
+type modpack struct {
+	Mods []packedMod
+}
+
+type packedMod struct {
+	Name   string
+	SHA256 string
+	// Explicit is false for mods that were only included as dependencies of other mods.
+	Explicit bool
+}
+
+func export(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("export: expected the name of the file to write")
+	}
+	settings, err := gameSettings()
+	if err != nil {
+		return err
+	}
+	repo, err := getModlinks(ctx)
+	if err != nil {
+		return err
+	}
+	man, err := manifest.Get(settings.GameLocation)
+	if err != nil {
+		return err
+	}
+	enabled, err := installedMods(pluginsDir(settings.GameLocation))
+	if err != nil {
+		return err
+	}
+	sort.Strings(enabled)
+	var pack modpack
+	for _, name := range enabled {
+		mod, err := repo.GetMod(name)
+		if err != nil {
+			fmt.Printf("warning: %s is not on modlinks, leaving it out\n", name)
+			continue
+		}
+		im, ok := man.Mods[name]
+		pack.Mods = append(pack.Mods, packedMod{
+			Name:     name,
+			SHA256:   mod.SHA256,
+			Explicit: !ok || im.Explicit,
+		})
+	}
+	if err := writeModpack(args[0], pack); err != nil {
+		return fmt.Errorf("export to %s: %w", args[0], err)
+	}
+	fmt.Printf("Exported %d mods to %s\n", len(pack.Mods), args[0])
+	return nil
+}
+
+func writeModpack(filename string, pack modpack) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := toml.NewEncoder(f).Encode(pack); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func importPack(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	var force bool
+	flags.BoolVar(&force, "force", false, "Install mods even if they conflict with each other")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) != 1 {
+		return errors.New("import: expected the name of the modpack file")
+	}
+	var pack modpack
+	if _, err := toml.DecodeFile(args[0], &pack); err != nil {
+		return fmt.Errorf("import %s: %w", args[0], err)
+	}
+	settings, err := gameSettings()
+	if err != nil {
+		return err
+	}
+	cachedir, err := os.UserCacheDir()
+	if err != nil {
+		return fmt.Errorf("cache directory not available: %w", err)
+	}
+	release, err := acquireLocks(gameLock(settings.GameLocation), cacheLock(cachedir))
+	if err != nil {
+		return err
+	}
+	defer release()
+	repo, err := getModlinks(ctx)
+	if err != nil {
+		return err
+	}
+	man, err := manifest.Get(settings.GameLocation)
+	if err != nil {
+		return err
+	}
+
+	// Check everything before installing anything, so that we don't end up with a
+	// half-imported pack.
+	var problems []string
+	names := make([]string, 0, len(pack.Mods))
+	requested := map[string]bool{}
+	for _, pm := range pack.Mods {
+		mod, err := repo.GetMod(pm.Name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s is not on modlinks", pm.Name))
+			continue
+		}
+		if !strings.EqualFold(mod.SHA256, pm.SHA256) {
+			problems = append(problems, fmt.Sprintf("%s: pack has version %s, but modlinks has %s", pm.Name, shortHash(pm.SHA256), shortHash(mod.SHA256)))
+			continue
+		}
+		names = append(names, pm.Name)
+		if pm.Explicit {
+			requested[pm.Name] = true
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("import %s: pack does not match modlinks:\n\t%s", args[0], strings.Join(problems, "\n\t"))
+	}
+
+	closure, err := repo.TransitiveClosure(names)
+	if err != nil {
+		return err
+	}
+	var changed []modlinks.Mod
+	for _, mod := range closure {
+		if _, status := checkMod(repo, man, mod.Name); status != statusUpToDate {
+			changed = append(changed, mod)
+		}
+	}
+	installed, err := installMods(ctx, settings.GameLocation, cachedir, man, changed, requested, force)
+	if err != nil {
+		return err
+	}
+	if err := manifest.Write(settings.GameLocation, man); err != nil {
+		return err
+	}
+	printModSummary("Installed", installed)
+	return nil
+}
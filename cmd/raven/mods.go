@@ -3,22 +3,28 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dpinela/Raven/internal/config"
+	"github.com/dpinela/Raven/internal/lockfile"
+	"github.com/dpinela/Raven/internal/manifest"
 	"github.com/dpinela/Raven/internal/modlinks"
 )
 
@@ -30,17 +36,26 @@ type modFile struct {
 	IsZIP bool
 }
 
-func getModFile(cachedir string, mod *modlinks.Mod) (*modFile, error) {
+// getModFile returns the file for a mod, downloading it if there isn't already a valid copy
+// in the cache.
+//
+// Cached files are named after their SHA-256 hashes, so that several versions of the same
+// mod can be kept at once, and mods that share the same file share a single cache entry.
+func getModFile(ctx context.Context, cachedir string, mod *modlinks.Mod) (*modFile, error) {
 	expectedSHA, err := hex.DecodeString(mod.SHA256)
 	if err != nil {
 		return nil, err
 	}
 	ext := path.Ext(mod.Link)
-	cacheEntry := filepath.Join(cachedir, appDirName, mod.Name+ext)
+	cacheEntry := filepath.Join(downloadCacheDir(cachedir), cacheKey(mod))
+	migrateLegacyCacheEntry(cachedir, mod, cacheEntry)
 	f, err := os.Open(cacheEntry)
 	if os.IsNotExist(err) {
-		fmt.Println("=> Installing", mod.Name, "from", mod.Link)
-		return downloadLink(cacheEntry, mod.Link, expectedSHA)
+		if options.offline {
+			return nil, errNotCached
+		}
+		syncPrintf("=> Installing %s from %s\n", mod.Name, mod.Link)
+		return downloadLink(ctx, cacheEntry, mod.Name, mod.Link, expectedSHA)
 	}
 	if err != nil {
 		return nil, err
@@ -53,13 +68,19 @@ func getModFile(cachedir string, mod *modlinks.Mod) (*modFile, error) {
 	}
 	if !bytes.Equal(expectedSHA, sha.Sum(make([]byte, 0, sha256.Size))) {
 		f.Close()
-		fmt.Println("=> Installing", mod.Name, "from", mod.Link)
-		return downloadLink(cacheEntry, mod.Link, expectedSHA)
+		if options.offline {
+			return nil, errNotCached
+		}
+		syncPrintf("=> Installing %s from %s\n", mod.Name, mod.Link)
+		return downloadLink(ctx, cacheEntry, mod.Name, mod.Link, expectedSHA)
 	}
-	fmt.Println("=> Installing", mod.Name, "from cache")
+	syncPrintf("=> Installing %s from cache\n", mod.Name)
+	touchCacheEntry(cacheEntry)
 	return &modFile{File: f, Size: size, IsZIP: ext == ".zip"}, nil
 }
 
+var errNotCached = errors.New("this version is not in the download cache, and Raven is working offline")
+
 func isatty(f *os.File) bool {
 	info, err := f.Stat()
 	if err != nil {
@@ -68,46 +89,179 @@ func isatty(f *os.File) bool {
 	return info.Mode()&os.ModeCharDevice != 0
 }
 
-func downloadLink(localfile string, url string, expectedSHA []byte) (*modFile, error) {
+// downloadLink downloads url into localfile, checking that its contents match expectedSHA.
+// name identifies the download in progress reports.
+//
+// The download is written to a separate partial file first, which is only moved into
+// place once it is complete and verified. If a previous download was interrupted,
+// downloadLink resumes it from where it left off if the server supports that.
+func downloadLink(ctx context.Context, localfile, name, url string, expectedSHA []byte) (*modFile, error) {
 	wrap := func(err error) error { return fmt.Errorf("download %s: %w", url, err) }
 
-	resp, err := http.Get(url)
+	if err := os.MkdirAll(filepath.Dir(localfile), 0750); err != nil {
+		return nil, wrap(err)
+	}
+	partfile := localfile + partialDownloadExt
+	attempts := max(httpClient.Retry.MaxAttempts, 1)
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = resumeDownload(ctx, partfile, name, url)
+		if errors.Is(err, errRangeNotSatisfiable) {
+			// We may already have the whole file, if the last attempt was cut short just
+			// before checking it; otherwise, whatever we had was no good, so start over.
+			if hash, hashErr := fileSHA256(partfile); hashErr == nil && hash == hex.EncodeToString(expectedSHA) {
+				err = nil
+				break
+			}
+			if err := os.Remove(partfile); err != nil {
+				return nil, wrap(err)
+			}
+			err = resumeDownload(ctx, partfile, name, url)
+		}
+		var ie *interruptedError
+		if !errors.As(err, &ie) || ctx.Err() != nil {
+			// If the user asked us to stop, the download was interrupted on purpose.
+			break
+		}
+		if attempt >= attempts {
+			if attempts > 1 {
+				err = fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+			}
+			break
+		}
+		syncPrintf("%s: %v; retrying\n", name, err)
+		if waitErr := httpClient.Wait(ctx, attempt); waitErr != nil {
+			err = waitErr
+			break
+		}
+	}
 	if err != nil {
 		return nil, wrap(err)
 	}
-	defer resp.Body.Close()
-	if !isHTTPOK(resp.StatusCode) {
-		return nil, fmt.Errorf("download %s: response status was %d", url, resp.StatusCode)
+
+	f, err := os.Open(partfile)
+	if err != nil {
+		return nil, wrap(err)
 	}
-	if err := os.MkdirAll(filepath.Dir(localfile), 0750); err != nil {
+	sha := sha256.New()
+	size, err := io.Copy(sha, f)
+	f.Close()
+	if err != nil {
 		return nil, wrap(err)
 	}
-	f, err := os.Create(localfile)
+	if !bytes.Equal(sha.Sum(make([]byte, 0, sha256.Size)), expectedSHA) {
+		os.Remove(partfile)
+		return nil, fmt.Errorf("download %s: sha256 does not match manifest", url)
+	}
+	if err := os.Rename(partfile, localfile); err != nil {
+		return nil, wrap(err)
+	}
+	f, err = os.Open(localfile)
 	if err != nil {
 		return nil, wrap(err)
 	}
+	return &modFile{File: f, Size: size, IsZIP: path.Ext(url) == ".zip"}, nil
+}
 
-	sha := sha256.New()
-	r := io.TeeReader(resp.Body, sha)
+const partialDownloadExt = ".part"
+
+var errRangeNotSatisfiable = errors.New("server cannot resume download")
+
+// interruptedError indicates that a download failed partway through, and may be
+// resumed.
+type interruptedError struct{ err error }
+
+func (err *interruptedError) Error() string { return "download interrupted: " + err.err.Error() }
+
+func (err *interruptedError) Unwrap() error { return err.err }
+
+// resumeDownload downloads the rest of url into partfile, starting from the end of its
+// existing contents, if any.
+func resumeDownload(ctx context.Context, partfile, name, url string) error {
+	var offset int64
+	if info, err := os.Stat(partfile); err == nil {
+		offset = info.Size()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Only create the partial file once we know there's something to put in it, so that
+	// failed requests don't leave empty ones behind.
+	flags := os.O_WRONLY | os.O_CREATE
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		syncPrintf("%s: resuming download from %s\n", name, dataSize(offset))
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		return errRangeNotSatisfiable
+	case isHTTPOK(resp.StatusCode):
+		// The server sent the whole file, so throw away what we had.
+		offset = 0
+		flags |= os.O_TRUNC
+	default:
+		return fmt.Errorf("response status was %d", resp.StatusCode)
+	}
+	f, err := os.OpenFile(partfile, flags, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bodyReader{resp.Body}
 	if isatty(os.Stdout) {
 		var counter byteCounter
+		counter.bytesWritten = dataSize(offset)
 		counter.updatePeriod = time.Second
-		if fullSize := dataSize(resp.ContentLength); fullSize != -1 {
-			counter.update = func(n dataSize) { fmt.Printf("downloading: %s of %s\n", n, fullSize) }
+		if resp.ContentLength != -1 {
+			fullSize := dataSize(offset + resp.ContentLength)
+			counter.update = func(n dataSize) { syncPrintf("%s: downloading: %s of %s\n", name, n, fullSize) }
 		} else {
-			counter.update = func(n dataSize) { fmt.Printf("downloading: %s of ???\n", n) }
+			counter.update = func(n dataSize) { syncPrintf("%s: downloading: %s of ???\n", name, n) }
 		}
 		r = io.TeeReader(r, &counter)
 	}
-	size, err := io.Copy(f, r)
-	if err != nil {
-		f.Close()
-		return nil, wrap(err)
+	if n, err := io.Copy(f, r); err != nil {
+		if offset+n == 0 {
+			f.Close()
+			os.Remove(partfile)
+		}
+		return err
 	}
-	if !bytes.Equal(sha.Sum(make([]byte, 0, sha256.Size)), expectedSHA) {
-		return nil, fmt.Errorf("download %s: sha256 does not match manifest", url)
+	return f.Close()
+}
+
+// bodyReader marks errors reading a response body as interruptions, to distinguish them
+// from errors writing the downloaded data.
+type bodyReader struct{ r io.Reader }
+
+func (br bodyReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &interruptedError{err}
 	}
-	return &modFile{File: f, Size: size, IsZIP: path.Ext(url) == ".zip"}, nil
+	return n, err
+}
+
+// outputMu serializes console output from concurrent downloads, so that their lines
+// don't get mixed together.
+var outputMu sync.Mutex
+
+func syncPrintf(format string, args ...any) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	fmt.Printf(format, args...)
 }
 
 type byteCounter struct {
@@ -143,13 +297,19 @@ func (n dataSize) String() string {
 
 func isHTTPOK(code int) bool { return code >= 200 && code < 300 }
 
-func extractZip(zipfile io.ReaderAt, size int64, name, installdir string) error {
+// extractZip extracts the contents of a ZIP archive into installdir, and returns the
+// slash-separated paths, relative to installdir, of all the files it wrote.
+func extractZip(ctx context.Context, zipfile io.ReaderAt, size int64, name, installdir string) ([]string, error) {
 	wrap := func(err error) error { return fmt.Errorf("extract %s: %w", name, err) }
 	archive, err := zip.NewReader(zipfile, size)
 	if err != nil {
-		return wrap(err)
+		return nil, wrap(err)
 	}
+	var files []string
 	for _, file := range archive.File {
+		if err := ctx.Err(); err != nil {
+			return nil, wrap(err)
+		}
 		// Prevent us from accidentally (or not so accidentally, in case of a malicious input)
 		// from writing outside the destination directory.
 		dest := joinNoEscape(installdir, filepath.FromSlash(file.Name))
@@ -157,12 +317,19 @@ func extractZip(zipfile io.ReaderAt, size int64, name, installdir string) error
 			err = os.MkdirAll(dest, 0750)
 		} else {
 			err = writeZipFile(dest, file)
+			files = append(files, cleanZipPath(file.Name))
 		}
 		if err != nil {
-			return wrap(err)
+			return nil, wrap(err)
 		}
 	}
-	return nil
+	return files, nil
+}
+
+// cleanZipPath returns the path relative to the extraction directory that
+// a ZIP entry named name ends up at, in the same way as joinNoEscape.
+func cleanZipPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
 }
 
 func joinNoEscape(parent string, child string) string {
@@ -201,25 +368,43 @@ func writeZipFile(dest string, file *zip.File) error {
 	return nil
 }
 
-func install(args []string) error {
-	settings, err := config.Get()
-	if err != nil {
+func install(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("install", flag.ContinueOnError)
+	var force bool
+	flags.BoolVar(&force, "force", false, "Install mods even if they conflict with each other")
+	var dryRun bool
+	flags.BoolVar(&dryRun, "dry-run", false, "Show what would be done, without changing anything")
+	if err := flags.Parse(args); err != nil {
 		return err
 	}
-	if settings.GameLocation == "" {
-		return errors.New("setup not done yet")
+	args = flags.Args()
+	settings, err := gameSettings()
+	if err != nil {
+		return err
 	}
 
 	cachedir, err := os.UserCacheDir()
 	if err != nil {
 		return fmt.Errorf("cache directory not available: %w", err)
 	}
+	if !dryRun {
+		release, err := acquireLocks(gameLock(settings.GameLocation), cacheLock(cachedir))
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
 
-	repo, err := modlinks.Get()
+	repo, err := loadModlinks(ctx, dryRun)
+	if err != nil {
+		return err
+	}
+	man, err := manifest.Get(settings.GameLocation)
 	if err != nil {
 		return err
 	}
 	resolvedMods := make([]string, 0, len(args))
+	requested := make(map[string]bool, len(args))
 	for _, requestedName := range args {
 		mod, err := repo.ResolveModName(requestedName)
 		if err != nil {
@@ -227,69 +412,228 @@ func install(args []string) error {
 			continue
 		}
 		resolvedMods = append(resolvedMods, mod)
+		requested[mod] = true
 	}
 
 	downloads, err := repo.TransitiveClosure(resolvedMods)
 	if err != nil {
 		return err
 	}
-	for _, dl := range downloads {
-		// There's no way we can reasonably install a mod whose name contains a path separator.
-		// This also avoids any path traversal vulnerabilities from mod names.
-		if strings.ContainsRune(dl.Name, filepath.Separator) {
-			fmt.Printf("cannot install %s: contains path separator\n", dl.Name)
-			continue
+	if dryRun {
+		return printInstallPlan(ctx, settings.GameLocation, cachedir, man, downloads)
+	}
+	if _, err := installMods(ctx, settings.GameLocation, cachedir, man, downloads, requested, force); err != nil {
+		return err
+	}
+	return manifest.Write(settings.GameLocation, man)
+}
+
+// installMods installs each of mods into the game at gameLocation, replacing any previously
+// installed versions, and records them in man. Mods named in requested are marked as having
+// been explicitly installed.
+//
+// Installation is all-or-nothing: every mod is first extracted into a staging directory,
+// and only once all of them have been extracted successfully are they moved into place.
+// If anything fails, the previously installed versions are left (or put back) as they were,
+// and installMods returns an error describing every failure.
+//
+// Unless force is true, installMods also refuses to install mods that conflict with each
+// other or with already installed mods; see findConflicts.
+func installMods(ctx context.Context, gameLocation, cachedir string, man manifest.Manifest, mods []modlinks.Mod, requested map[string]bool, force bool) ([]string, error) {
+	if err := recoverInterruptedInstall(gameLocation); err != nil {
+		return nil, err
+	}
+	stagingdir := filepath.Join(gameLocation, "BepInEx", stagingDirName)
+	defer os.RemoveAll(stagingdir)
+	defer func() {
+		if err := enforceCacheLimit(cachedir); err != nil {
+			fmt.Println("warning:", err)
 		}
-		if strings.ContainsRune(path.Base(dl.Link), filepath.Separator) {
-			fmt.Printf("cannot install %s: filename contains path separator\n", dl.Name)
+	}()
+
+	// Extract mods in a consistent order, regardless of the order they finish downloading in.
+	mods = slices.Clone(mods)
+	slices.SortFunc(mods, func(a, b modlinks.Mod) int { return strings.Compare(a.Name, b.Name) })
+
+	var errs []error
+	downloads := fetchMods(ctx, cachedir, mods, downloadLimit())
+	defer func() {
+		for _, d := range downloads {
+			if d.file != nil {
+				d.file.Close()
+			}
+		}
+	}()
+	contents := make(map[string][]archivedFile, len(mods))
+	incoming := make(map[string][]string, len(mods))
+	for i, dl := range mods {
+		if downloads[i].err != nil {
+			errs = append(errs, fmt.Errorf("cannot install %s: %w", dl.Name, downloads[i].err))
 			continue
 		}
-		file, err := getModFile(cachedir, &dl)
+		archived, err := archivedFiles(downloads[i].file, &dl)
 		if err != nil {
-			fmt.Printf("cannot install %s: %v\n", dl.Name, err)
+			errs = append(errs, fmt.Errorf("cannot install %s: %w", dl.Name, err))
 			continue
 		}
-		installdir := filepath.Join(settings.GameLocation, "BepInEx", "plugins", dl.Name)
-		if err := removePreviousVersion(dl.Name, installdir); err != nil {
-			fmt.Printf("cannot install %s: %v\n", dl.Name, err)
-			file.Close()
+		contents[dl.Name] = archived
+		incoming[dl.Name] = archivedNames(archived)
+	}
+	if len(errs) == 0 {
+		conflicts, err := findConflicts(pluginsDir(gameLocation), man, incoming)
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case len(conflicts) > 0 && !force:
+			errs = append(errs, conflictsError(conflicts))
+		case len(conflicts) > 0:
+			for _, c := range conflicts {
+				fmt.Println("warning:", c)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w\nno mods were changed", errors.Join(errs...))
+	}
+
+	// Settings only affect which files are preserved, so carry on without them if need be.
+	settings, _ := config.Get()
+	modsdir := pluginsDir(gameLocation)
+	staged := make([]string, 0, len(mods))
+	files := make(map[string][]string, len(mods))
+	for i, dl := range mods {
+		extracted, err := stageMod(ctx, stagingdir, downloads[i].file, &dl)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot install %s: %w", dl.Name, err))
 			continue
 		}
-		if file.IsZIP {
-			err = extractZip(file, file.Size, dl.Name, installdir)
-		} else {
-			err = extractModDLL(file, path.Base(dl.Link), installdir)
+		var previous *manifest.Mod
+		if im, ok := man.Mods[dl.Name]; ok {
+			previous = &im
 		}
-		file.Close()
+		installdir := modDir(modsdir, dl.Name)
+		err = preserveUserFiles(cachedir, installdir, filepath.Join(stagingdir, dl.Name), previous, contents[dl.Name], settings.PreservePatterns(dl.Name))
 		if err != nil {
-			fmt.Printf("cannot install %s: %v\n", dl.Name, err)
+			errs = append(errs, fmt.Errorf("cannot install %s: %w", dl.Name, err))
+			continue
 		}
+		staged = append(staged, dl.Name)
+		files[dl.Name] = extracted
 	}
-	return nil
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w\nno mods were changed", errors.Join(errs...))
+	}
+	if err := commitStagedMods(gameLocation, staged); err != nil {
+		return nil, err
+	}
+	for _, dl := range mods {
+		man.Mods[dl.Name] = manifest.Mod{
+			Link:        dl.Link,
+			SHA256:      dl.SHA256,
+			InstalledAt: time.Now().UTC(),
+			Files:       files[dl.Name],
+			Explicit:    requested[dl.Name] || man.Mods[dl.Name].Explicit,
+		}
+	}
+	return staged, nil
+}
+
+const defaultDownloadLimit = 4
+
+// downloadLimit returns the maximum number of mods to download at once.
+func downloadLimit() int {
+	if options.downloadLimit > 0 {
+		return options.downloadLimit
+	}
+	if settings, err := config.Get(); err == nil && settings.DownloadLimit > 0 {
+		return settings.DownloadLimit
+	}
+	return defaultDownloadLimit
+}
+
+type fetchResult struct {
+	file *modFile
+	err  error
+}
+
+// fetchMods gets the files for all of mods, either from the cache or by downloading them,
+// with up to limit downloads happening at once. The result for each mod is at the same index
+// as the mod itself.
+func fetchMods(ctx context.Context, cachedir string, mods []modlinks.Mod, limit int) []fetchResult {
+	results := make([]fetchResult, len(mods))
+	// Mods that share the same file must not download it at the same time; whichever
+	// gets to it last will find it in the cache.
+	keyLocks := make(map[string]*sync.Mutex, len(mods))
+	for i := range mods {
+		keyLocks[cacheKey(&mods[i])] = new(sync.Mutex)
+	}
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(limit, len(mods)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				lock := keyLocks[cacheKey(&mods[i])]
+				lock.Lock()
+				results[i] = fetchMod(ctx, cachedir, &mods[i])
+				lock.Unlock()
+			}
+		}()
+	}
+	for i := range mods {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+func fetchMod(ctx context.Context, cachedir string, dl *modlinks.Mod) fetchResult {
+	// There's no way we can reasonably install a mod whose name contains a path separator.
+	// This also avoids any path traversal vulnerabilities from mod names.
+	if strings.ContainsRune(dl.Name, filepath.Separator) {
+		return fetchResult{err: errors.New("contains path separator")}
+	}
+	if strings.ContainsRune(path.Base(dl.Link), filepath.Separator) {
+		return fetchResult{err: errors.New("filename contains path separator")}
+	}
+	file, err := getModFile(ctx, cachedir, dl)
+	return fetchResult{file, err}
+}
+
+// stageMod extracts a mod's file into a subdirectory of stagingdir named after it,
+// returning the list of files it extracted.
+func stageMod(ctx context.Context, stagingdir string, file *modFile, dl *modlinks.Mod) ([]string, error) {
+	installdir := filepath.Join(stagingdir, dl.Name)
+	if file.IsZIP {
+		return extractZip(ctx, file, file.Size, dl.Name, installdir)
+	}
+	return extractModDLL(file, path.Base(dl.Link), installdir)
 }
 
-func extractModDLL(dllfile io.ReadSeeker, filename, installdir string) error {
+func extractModDLL(dllfile io.ReadSeeker, filename, installdir string) ([]string, error) {
 	wrap := func(err error) error { return fmt.Errorf("extract %s: %w", filename, err) }
 	dest := joinNoEscape(installdir, filename)
 	if err := os.MkdirAll(installdir, 0750); err != nil {
-		return wrap(err)
+		return nil, wrap(err)
 	}
 	if _, err := dllfile.Seek(0, io.SeekStart); err != nil {
-		return wrap(err)
+		return nil, wrap(err)
 	}
 	w, err := os.Create(dest)
 	if err != nil {
-		return wrap(err)
+		return nil, wrap(err)
 	}
 	_, err = io.Copy(w, dllfile)
 	if err != nil {
 		w.Close()
-		return wrap(err)
+		return nil, wrap(err)
 	}
 	if err := w.Close(); err != nil {
-		return wrap(err)
+		return nil, wrap(err)
 	}
-	return nil
+	return []string{cleanZipPath(filename)}, nil
 }
 
 func removePreviousVersion(name, installdir string) error {
@@ -300,7 +644,7 @@ func removePreviousVersion(name, installdir string) error {
 	return fmt.Errorf("yeet installed version of %s: %w", name, err)
 }
 
-func list(args []string) error {
+func list(ctx context.Context, args []string) error {
 	flags := flag.NewFlagSet("list", flag.ContinueOnError)
 	var detailed bool
 	var installed bool
@@ -311,25 +655,50 @@ func list(args []string) error {
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
-	repo, err := modlinks.Get()
+	repo, err := getModlinks(ctx)
 	if err != nil {
 		return err
 	}
 	knownNames := repo.ModNames()
 	var modFilter filter
+	var man manifest.Manifest
+	disabled := map[string]bool{}
 	if installed {
-		settings, err := config.Get()
+		settings, err := gameSettings()
 		if err != nil {
 			return err
 		}
-		if settings.GameLocation == "" {
-			return errors.New("setup not done yet")
-		}
-		installdir := filepath.Join(settings.GameLocation, "BepInEx", "plugins")
+		installdir := pluginsDir(settings.GameLocation)
 		mods, err := installedMods(installdir)
 		if err != nil {
 			return err
 		}
+		disabledNames, err := disabledMods(installdir)
+		if err != nil {
+			return err
+		}
+		for _, name := range disabledNames {
+			disabled[name] = true
+		}
+		for _, name := range mods {
+			delete(disabled, name)
+		}
+		for name := range disabled {
+			mods = append(mods, name)
+		}
+		man, err = manifest.Get(settings.GameLocation)
+		if err != nil {
+			return err
+		}
+		// Forget about any mods that were removed by something other than Raven. Saving
+		// that is only housekeeping, so leave it for later if another Raven is busy with
+		// the game.
+		if man.Prune(mods) {
+			var locked *lockfile.LockedError
+			if err := pruneManifest(settings.GameLocation); err != nil && !errors.As(err, &locked) {
+				return err
+			}
+		}
 		modSet := make(map[string]bool, len(mods))
 		for _, im := range mods {
 			modSet[im] = false
@@ -376,7 +745,11 @@ func list(args []string) error {
 				Repository:   placeholder,
 			}
 		}
-		fmt.Println(m.Name)
+		if disabled[name] {
+			fmt.Println(m.Name, "(disabled)")
+		} else {
+			fmt.Println(m.Name)
+		}
 		if detailed {
 			fmt.Println("\tRepository:", m.Repository)
 			deps := "none"
@@ -384,12 +757,36 @@ func list(args []string) error {
 				deps = strings.Join(m.Dependencies, ", ")
 			}
 			fmt.Println("\tDependencies:", deps)
+			if installed {
+				im, ok := man.Mods[name]
+				fmt.Println("\tInstalled:", describeInstall(im, ok))
+			}
 			fmt.Printf("\t%s\n\n", strings.ReplaceAll(m.Description, "\n", "\n\t"))
 		}
 	}
 	return nil
 }
 
+func describeInstall(im manifest.Mod, inManifest bool) string {
+	if !inManifest {
+		return "unknown version (not installed by Raven)"
+	}
+	reason := "as a dependency"
+	if im.Explicit {
+		reason = "explicitly"
+	}
+	return fmt.Sprintf("%s on %s, %s", shortHash(im.SHA256), im.InstalledAt.Local().Format(time.DateTime), reason)
+}
+
+// shortHash abbreviates a hex-encoded hash for display.
+func shortHash(h string) string {
+	const n = 12
+	if len(h) > n {
+		return h[:n]
+	}
+	return h
+}
+
 type filter func(string) bool
 
 func (f filter) and(g filter) filter {
@@ -409,37 +806,132 @@ func (f filter) test(x string) bool {
 	return f(x)
 }
 
-func yeet(args []string) error {
-	settings, err := config.Get()
+func yeet(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("yeet", flag.ContinueOnError)
+	var dryRun, withDeps bool
+	flags.BoolVar(&dryRun, "dry-run", false, "Show what would be deleted, without deleting anything")
+	flags.BoolVar(&withDeps, "with-deps", false, "Also yeet dependencies that are no longer needed by other mods")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	settings, err := gameSettings()
 	if err != nil {
 		return err
 	}
-	if settings.GameLocation == "" {
-		return errors.New("setup not done yet")
+	if !dryRun {
+		release, err := acquireLocks(gameLock(settings.GameLocation))
+		if err != nil {
+			return err
+		}
+		defer release()
 	}
 
-	modsdir := filepath.Join(settings.GameLocation, "BepInEx", "plugins")
-	mods, err := installedMods(modsdir)
+	modsdir := pluginsDir(settings.GameLocation)
+	mods, err := allInstalledMods(modsdir)
 	if err != nil {
 		return err
 	}
-	modsToDelete := map[string]struct{}{}
+	modsToDelete := map[string]bool{}
 	for _, arg := range args {
 		resolved, err := modlinks.ResolveModName(mods, arg)
 		if err != nil {
 			fmt.Println(err)
 			continue
 		}
-		modsToDelete[resolved] = struct{}{}
+		modsToDelete[resolved] = true
+	}
+	man, err := manifest.Get(settings.GameLocation)
+	if err != nil {
+		return err
+	}
+	// Mods can be yeeted without modlinks, as long as we don't need to know what depends
+	// on what.
+	repo, err := loadModlinks(ctx, dryRun)
+	if err != nil {
+		if withDeps {
+			return err
+		}
+		fmt.Println("warning: cannot check whether other mods depend on these:", err)
+	} else {
+		if withDeps && len(modsToDelete) > 0 {
+			orphans := orphanedMods(repo, man, without(mods, modsToDelete))
+			for _, name := range orphans {
+				modsToDelete[name] = true
+			}
+			printModSummary("No longer needed", orphans)
+		}
+		warnDependents(repo, without(mods, modsToDelete), modsToDelete)
+	}
+	return yeetMods(settings.GameLocation, man, modsToDelete, dryRun)
+}
+
+// yeetMods removes each of the named mods and their entries in the manifest, or, if
+// dryRun is true, only lists the files that would be removed.
+func yeetMods(gameLocation string, man manifest.Manifest, names map[string]bool, dryRun bool) error {
+	modsdir := pluginsDir(gameLocation)
+	sorted := make([]string, 0, len(names))
+	for mod := range names {
+		sorted = append(sorted, mod)
+	}
+	sort.Strings(sorted)
+	if dryRun {
+		for _, mod := range sorted {
+			fmt.Println("Would yeet", mod)
+			if err := printModDeletion(modsdir, mod, nil); err != nil {
+				fmt.Println(err)
+			}
+		}
+		return nil
 	}
-	for mod := range modsToDelete {
-		if err := removePreviousVersion(mod, modsdir); err != nil {
+	for _, mod := range sorted {
+		if err := removePreviousVersion(mod, modDir(modsdir, mod)); err != nil {
 			fmt.Println(err)
 		} else {
+			delete(man.Mods, mod)
 			fmt.Println("Yeeted", mod)
 		}
 	}
-	return nil
+	return manifest.Write(gameLocation, man)
+}
+
+// pruneManifest removes the manifest entries for mods that are no longer installed in the
+// game at gameLocation.
+func pruneManifest(gameLocation string) error {
+	release, err := acquireLocks(gameLock(gameLocation))
+	if err != nil {
+		return err
+	}
+	defer release()
+	// Another Raven may have changed what is installed before we took the lock.
+	mods, err := allInstalledMods(pluginsDir(gameLocation))
+	if err != nil {
+		return err
+	}
+	man, err := manifest.Get(gameLocation)
+	if err != nil {
+		return err
+	}
+	if !man.Prune(mods) {
+		return nil
+	}
+	return manifest.Write(gameLocation, man)
+}
+
+// gameSettings returns the current settings, or an error if setup hasn't been done yet.
+func gameSettings() (config.Settings, error) {
+	settings, err := config.Get()
+	if err != nil {
+		return config.Settings{}, err
+	}
+	if settings.GameLocation == "" {
+		return config.Settings{}, errors.New("setup not done yet")
+	}
+	return settings, nil
+}
+
+func pluginsDir(gameLocation string) string {
+	return filepath.Join(gameLocation, "BepInEx", "plugins")
 }
 
 func installedMods(modsdir string) ([]string, error) {
@@ -448,6 +940,10 @@ func installedMods(modsdir string) ([]string, error) {
 	}
 
 	dir, err := os.Open(modsdir)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Setup doesn't create the plugins directory; it appears with the first mod.
+		return nil, nil
+	}
 	if err != nil {
 		return nil, wrap(err)
 	}
@@ -459,7 +955,7 @@ func installedMods(modsdir string) ([]string, error) {
 	// We expect almost all of the entries in the Mods directory to be actual mods.
 	modnames := make([]string, 0, len(entries))
 	for _, e := range entries {
-		if e.IsDir() && !strings.EqualFold(strings.TrimSpace(e.Name()), "Disabled") {
+		if e.IsDir() && !isDisabledDirName(e.Name()) {
 			modnames = append(modnames, e.Name())
 		}
 	}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadLinkResumes(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var gotRange string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		http.ServeContent(w, r, "Mod.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	localfile := filepath.Join(t.TempDir(), "Mod.zip")
+	writeTestFile(t, localfile+partialDownloadExt, string(content[:4000]))
+	sum := sha256.Sum256(content)
+	f, err := downloadLink(context.Background(), localfile, "Mod", srv.URL+"/Mod.zip", sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if want := "bytes=4000-"; gotRange != want {
+		t.Errorf("got Range %q, want %q", gotRange, want)
+	}
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded file has wrong contents")
+	}
+	if _, err := os.Stat(localfile + partialDownloadExt); !os.IsNotExist(err) {
+		t.Errorf("partial file still exists: %v", err)
+	}
+}
+
+func TestDownloadLinkFailureLeavesNoPartialFile(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	localfile := filepath.Join(t.TempDir(), "Mod.zip")
+	sum := sha256.Sum256(nil)
+	if f, err := downloadLink(context.Background(), localfile, "Mod", srv.URL+"/Mod.zip", sum[:]); err == nil {
+		f.Close()
+		t.Fatal("download of missing file succeeded")
+	}
+	if _, err := os.Stat(localfile + partialDownloadExt); !os.IsNotExist(err) {
+		t.Errorf("partial file exists after failed download: %v", err)
+	}
+}
+
+func TestDownloadLinkKeepsCompletePartialFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeContent(w, r, "Mod.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	localfile := filepath.Join(t.TempDir(), "Mod.zip")
+	writeTestFile(t, localfile+partialDownloadExt, string(content))
+	sum := sha256.Sum256(content)
+	f, err := downloadLink(context.Background(), localfile, "Mod", srv.URL+"/Mod.zip", sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if requests != 1 {
+		t.Errorf("made %d requests, want 1", requests)
+	}
+	got, err := os.ReadFile(localfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded file has wrong contents")
+	}
+}
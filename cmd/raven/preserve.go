@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+// preserveUserFiles copies files that belong to the user from the installed version of a
+// mod, in installdir, into its new version, staged in stagedir, so that they survive the
+// new version replacing the old one. The arguments are as for userFiles.
+func preserveUserFiles(cachedir, installdir, stagedir string, previous *manifest.Mod, next []archivedFile, patterns []string) error {
+	kept, err := userFiles(cachedir, installdir, previous, next, patterns)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(installdir)
+	for _, f := range kept {
+		src := filepath.Join(installdir, filepath.FromSlash(f))
+		if err := copyFile(src, joinNoEscape(stagedir, filepath.FromSlash(f))); err != nil {
+			return fmt.Errorf("preserve %s: %w", f, err)
+		}
+		fmt.Printf("=> Keeping %s from the previous version of %s\n", f, name)
+	}
+	return nil
+}
+
+// userFiles returns the files in installdir, the installed version of a mod, that belong
+// to the user and should be carried over into its new version. previous is the installed
+// version's manifest entry, or nil if Raven didn't install it, and next lists the files
+// in the new version.
+//
+// A file belongs to the user if it matches any of patterns, or, if previous isn't nil,
+// if it wasn't part of the installed version, or if it was but has been modified since
+// then. DLLs are never carried over, since the code has to match the version being
+// installed. Nor are files that weren't part of the installed version but are part of
+// the new one, or modified files that the new version changes too, since the user's
+// version probably isn't compatible with it; a warning is printed for those.
+//
+// Patterns use the syntax of path.Match. Those without a slash match files with that
+// name in any directory; the others match paths relative to installdir.
+func userFiles(cachedir, installdir string, previous *manifest.Mod, next []archivedFile, patterns []string) ([]string, error) {
+	present, err := dirFiles(installdir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(installdir)
+
+	var original map[string]archivedFile
+	known := map[string]bool{}
+	if previous != nil {
+		for _, f := range previous.Files {
+			known[f] = true
+		}
+		// If the installed version's archive is no longer in the cache, we can't tell
+		// which of its files have been modified, but we can still keep the extra ones.
+		prevMod := modlinks.Mod{Name: name, Link: previous.Link, SHA256: previous.SHA256}
+		if file := lookupCachedFile(cachedir, &prevMod); file != nil {
+			archived, err := archivedFiles(file, &prevMod)
+			file.Close()
+			if err == nil {
+				original = make(map[string]archivedFile, len(archived))
+				for _, af := range archived {
+					original[af.name] = af
+				}
+			}
+		}
+	}
+	updated := make(map[string]archivedFile, len(next))
+	for _, af := range next {
+		updated[af.name] = af
+	}
+
+	var kept []string
+	for _, f := range present {
+		if strings.EqualFold(path.Ext(f), ".dll") {
+			continue
+		}
+		keep, err := matchesAny(patterns, f)
+		if err != nil {
+			return nil, err
+		}
+		nf, shipped := updated[f]
+		switch {
+		case keep:
+		case previous == nil:
+			// Without knowing what was installed, only the patterns can tell us what
+			// to keep.
+		case !known[f]:
+			if shipped {
+				fmt.Printf("warning: %s: %s was added since it was installed, but the new version includes it; replacing it\n", name, f)
+				break
+			}
+			keep = true
+		default:
+			orig, ok := original[f]
+			if !ok {
+				break
+			}
+			same, err := orig.matches(filepath.Join(installdir, filepath.FromSlash(f)))
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				break
+			}
+			if shipped && (nf.size != orig.size || nf.crc32 != orig.crc32) {
+				fmt.Printf("warning: %s: %s was modified, but the new version changes it too; replacing it\n", name, f)
+				break
+			}
+			keep = true
+		}
+		if keep {
+			kept = append(kept, f)
+		}
+	}
+	return kept, nil
+}
+
+func matchesAny(patterns []string, name string) (bool, error) {
+	for _, p := range patterns {
+		target := name
+		if !strings.Contains(p, "/") {
+			target = path.Base(name)
+		}
+		ok, err := path.Match(p, target)
+		if err != nil {
+			return false, fmt.Errorf("preserve pattern %q: %w", p, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func copyFile(src, dest string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := os.MkdirAll(filepath.Dir(dest), 0750); err != nil {
+		return err
+	}
+	w, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
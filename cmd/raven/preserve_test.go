@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/dpinela/Raven/internal/manifest"
+)
+
+func TestPreserveUserFiles(t *testing.T) {
+	installdir := filepath.Join(t.TempDir(), "Plando")
+	stagedir := filepath.Join(t.TempDir(), "Plando")
+	for _, name := range []string{"Plando.dll", "settings.json", "notes.txt", "saves/slot1.dat"} {
+		writeTestFile(t, filepath.Join(installdir, filepath.FromSlash(name)), name)
+	}
+	previous := &manifest.Mod{
+		Link:   "https://example.com/Plando.zip",
+		SHA256: "00",
+		Files:  []string{"Plando.dll", "settings.json", "saves/slot1.dat"},
+	}
+	if err := preserveUserFiles(t.TempDir(), installdir, stagedir, previous, nil, []string{"saves/*"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dirFiles(stagedir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	want := []string{"notes.txt", "saves/slot1.dat"}
+	if !slices.Equal(got, want) {
+		t.Errorf("preserved %v, want %v", got, want)
+	}
+	if content, err := os.ReadFile(filepath.Join(stagedir, "notes.txt")); err != nil || string(content) != "notes.txt" {
+		t.Errorf("notes.txt was not copied correctly: %q, %v", content, err)
+	}
+}
+
+func TestPreserveUserFilesAgainstNewVersion(t *testing.T) {
+	cachedir := t.TempDir()
+	oldFiles := map[string]string{
+		"Plando.dll":     "plando 1",
+		"settings.json":  "{}",
+		"defaults.json":  "{}",
+		"presets/a.json": "a",
+	}
+	newFiles := map[string]string{
+		"Plando.dll":     "plando 2",
+		"settings.json":  "{}",
+		"defaults.json":  `{"new": true}`,
+		"presets/a.json": "a",
+		"presets/b.json": "b",
+		"Helper.dll":     "helper",
+	}
+	oldMod := writeTestArchive(t, cachedir, "Plando", oldFiles)
+	newMod := writeTestArchive(t, cachedir, "Plando", newFiles)
+
+	installdir := filepath.Join(t.TempDir(), "Plando")
+	for name, content := range oldFiles {
+		writeTestFile(t, filepath.Join(installdir, filepath.FromSlash(name)), content)
+	}
+	// The user changed a file that the new version leaves alone, and one that it
+	// changes; patched the DLL; and added files, some of which the new version also
+	// includes.
+	changes := map[string]string{
+		"settings.json":  `{"user": true}`,
+		"defaults.json":  `{"user": true}`,
+		"Plando.dll":     "patched",
+		"presets/b.json": "mine",
+		"presets/c.json": "mine too",
+		"Helper.dll":     "mine",
+		"Extra.dll":      "mine",
+	}
+	for name, content := range changes {
+		writeTestFile(t, filepath.Join(installdir, filepath.FromSlash(name)), content)
+	}
+	stagedir := filepath.Join(t.TempDir(), "Plando")
+	for name, content := range newFiles {
+		writeTestFile(t, filepath.Join(stagedir, filepath.FromSlash(name)), content)
+	}
+
+	file := lookupCachedFile(cachedir, &newMod)
+	if file == nil {
+		t.Fatal("new version is missing from the cache")
+	}
+	next, err := archivedFiles(file, &newMod)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := &manifest.Mod{Link: oldMod.Link, SHA256: oldMod.SHA256}
+	for name := range oldFiles {
+		previous.Files = append(previous.Files, name)
+	}
+	if err := preserveUserFiles(cachedir, installdir, stagedir, previous, next, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"Plando.dll":     "plando 2",
+		"settings.json":  `{"user": true}`,
+		"defaults.json":  `{"new": true}`,
+		"presets/a.json": "a",
+		"presets/b.json": "b",
+		"presets/c.json": "mine too",
+		"Helper.dll":     "helper",
+	}
+	got, err := dirFiles(stagedir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	var wantNames []string
+	for name := range want {
+		wantNames = append(wantNames, name)
+	}
+	slices.Sort(wantNames)
+	if !slices.Equal(got, wantNames) {
+		t.Errorf("staged %v, want %v", got, wantNames)
+	}
+	for name, content := range want {
+		b, err := os.ReadFile(filepath.Join(stagedir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(b) != content {
+			t.Errorf("%s contains %q, want %q", name, b, content)
+		}
+	}
+}
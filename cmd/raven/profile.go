@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/dpinela/Raven/internal/config"
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+func profile(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("profile: expected a subcommand: create, switch, list or delete")
+	}
+	switch args[0] {
+	case "create":
+		return profileCreate(ctx, args[1:])
+	case "switch":
+		return profileSwitch(ctx, args[1:])
+	case "list":
+		return profileList(ctx, args[1:])
+	case "delete":
+		return profileDelete(ctx, args[1:])
+	default:
+		return fmt.Errorf("profile: unknown subcommand: %s", args[0])
+	}
+}
+
+func profileCreate(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("profile create: expected a profile name")
+	}
+	name := args[0]
+	var mods []string
+	if len(args) > 1 {
+		repo, err := getModlinks(ctx)
+		if err != nil {
+			return err
+		}
+		for _, requestedName := range args[1:] {
+			mod, err := repo.ResolveModName(requestedName)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			mods = append(mods, mod)
+		}
+	} else {
+		var err error
+		mods, err = currentModSet()
+		if err != nil {
+			return err
+		}
+	}
+	sort.Strings(mods)
+	if err := config.WriteProfile(name, config.Profile{Mods: mods}); err != nil {
+		return fmt.Errorf("profile create: %w", err)
+	}
+	fmt.Printf("Created profile %s with %d mods\n", name, len(mods))
+	return nil
+}
+
+// currentModSet returns the enabled mods that were either explicitly installed, or
+// installed by something other than Raven; that is, the mods that would need to be
+// installed to reproduce the current setup.
+func currentModSet() ([]string, error) {
+	settings, err := gameSettings()
+	if err != nil {
+		return nil, err
+	}
+	man, err := manifest.Get(settings.GameLocation)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := installedMods(pluginsDir(settings.GameLocation))
+	if err != nil {
+		return nil, err
+	}
+	mods := enabled[:0]
+	for _, name := range enabled {
+		if im, ok := man.Mods[name]; !ok || im.Explicit {
+			mods = append(mods, name)
+		}
+	}
+	return mods, nil
+}
+
+func profileList(ctx context.Context, args []string) error {
+	names, err := config.ProfileNames()
+	if err != nil {
+		return fmt.Errorf("profile list: %w", err)
+	}
+	// The current profile is only a convenience, so don't fail if we can't get it.
+	settings, _ := config.Get()
+	sort.Strings(names)
+	for _, name := range names {
+		if name == settings.CurrentProfile {
+			fmt.Println(name, "(current)")
+		} else {
+			fmt.Println(name)
+		}
+	}
+	return nil
+}
+
+func profileDelete(ctx context.Context, args []string) error {
+	for _, name := range args {
+		if err := config.DeleteProfile(name); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println("Deleted profile", name)
+	}
+	return nil
+}
+
+func profileSwitch(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("profile switch", flag.ContinueOnError)
+	var remove bool
+	flags.BoolVar(&remove, "remove", false, "Remove mods not in the profile, instead of disabling them")
+	var force bool
+	flags.BoolVar(&force, "force", false, "Install mods even if they conflict with each other")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("profile switch: expected a profile name")
+	}
+	name := flags.Arg(0)
+	prof, err := config.GetProfile(name)
+	if err != nil {
+		return err
+	}
+	settings, err := gameSettings()
+	if err != nil {
+		return err
+	}
+	cachedir, err := os.UserCacheDir()
+	if err != nil {
+		return fmt.Errorf("cache directory not available: %w", err)
+	}
+	release, err := acquireLocks(gameLock(settings.GameLocation), cacheLock(cachedir))
+	if err != nil {
+		return err
+	}
+	defer release()
+	repo, err := getModlinks(ctx)
+	if err != nil {
+		return err
+	}
+	man, err := manifest.Get(settings.GameLocation)
+	if err != nil {
+		return err
+	}
+	modsdir := pluginsDir(settings.GameLocation)
+	enabledNames, err := installedMods(modsdir)
+	if err != nil {
+		return err
+	}
+	disabledNames, err := disabledMods(modsdir)
+	if err != nil {
+		return err
+	}
+	enabled := stringSet(enabledNames)
+	disabled := stringSet(disabledNames)
+
+	wanted := map[string]bool{}
+	var listed []string
+	requested := map[string]bool{}
+	for _, mod := range prof.Mods {
+		wanted[mod] = true
+		requested[mod] = true
+		if _, err := repo.GetMod(mod); err == nil {
+			listed = append(listed, mod)
+		} else if !enabled[mod] && !disabled[mod] {
+			fmt.Printf("cannot install %s: not on modlinks\n", mod)
+		}
+	}
+	closure, err := repo.TransitiveClosure(listed)
+	if err != nil {
+		return err
+	}
+	var missing []modlinks.Mod
+	for _, mod := range closure {
+		wanted[mod.Name] = true
+		if !enabled[mod.Name] && !disabled[mod.Name] {
+			missing = append(missing, mod)
+		}
+	}
+
+	// Install first, so that if that fails, nothing will have changed.
+	if _, err := installMods(ctx, settings.GameLocation, cachedir, man, missing, requested, force); err != nil {
+		return err
+	}
+	for _, mod := range missing {
+		fmt.Println("Installed", mod.Name)
+	}
+	// Mods the profile lists are wanted for their own sake, even if they were only
+	// installed as dependencies before.
+	for mod := range requested {
+		if im, ok := man.Mods[mod]; ok && !im.Explicit {
+			im.Explicit = true
+			man.Mods[mod] = im
+		}
+	}
+	sort.Strings(disabledNames)
+	for _, mod := range disabledNames {
+		if wanted[mod] && !enabled[mod] {
+			if err := enableMod(modsdir, mod); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Println("Enabled", mod)
+		}
+	}
+	installed, err := allInstalledMods(modsdir)
+	if err != nil {
+		return err
+	}
+	sort.Strings(installed)
+	for _, mod := range installed {
+		if wanted[mod] {
+			continue
+		}
+		if remove {
+			if err := removePreviousVersion(mod, modDir(modsdir, mod)); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			delete(man.Mods, mod)
+			fmt.Println("Yeeted", mod)
+		} else if enabled[mod] {
+			if err := disableMod(modsdir, mod); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Println("Disabled", mod)
+		}
+	}
+	if err := manifest.Write(settings.GameLocation, man); err != nil {
+		return err
+	}
+	settings.CurrentProfile = name
+	return config.Write(settings)
+}
+
+func stringSet(xs []string) map[string]bool {
+	set := make(map[string]bool, len(xs))
+	for _, x := range xs {
+		set[x] = true
+	}
+	return set
+}
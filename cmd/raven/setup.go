@@ -1,16 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/dpinela/Raven/internal/config"
-	"github.com/dpinela/Raven/internal/modlinks"
 )
 
-func setup(args []string) error {
+func setup(ctx context.Context, args []string) error {
 	if len(args) > 1 {
 		return fmt.Errorf("setup: %d arguments provided, expect 1 (does game path have spaces?)", len(args))
 	}
@@ -39,8 +39,13 @@ func setup(args []string) error {
 	if err != nil {
 		return wrap(err)
 	}
+	release, err := acquireLocks(gameLock(location), cacheLock(cachedir))
+	if err != nil {
+		return wrap(err)
+	}
+	defer release()
 
-	r, err := modlinks.Get()
+	r, err := getModlinks(ctx)
 	if err != nil {
 		return wrap(err)
 	}
@@ -48,22 +53,51 @@ func setup(args []string) error {
 	if err != nil {
 		return wrap(err)
 	}
-	f, err := getModFile(cachedir, &bie)
+	f, err := getModFile(ctx, cachedir, &bie)
 	if err != nil {
 		return wrap(err)
 	}
-	err = extractZip(f, f.Size, bie.Name, location)
+	// Extract BepInEx somewhere else first, so that cancelling setup partway through
+	// doesn't leave half of it installed.
+	stagingdir := filepath.Join(location, "BepInEx", setupStagingDirName)
+	if err := os.RemoveAll(stagingdir); err != nil {
+		return wrap(err)
+	}
+	defer os.RemoveAll(stagingdir)
+	files, err := extractZip(ctx, f, f.Size, bie.Name, stagingdir)
 	f.Close()
 	if err != nil {
 		return wrap(err)
 	}
-	err = config.Write(config.Settings{GameLocation: location})
+	if err := moveStagedFiles(stagingdir, location, files); err != nil {
+		return wrap(err)
+	}
+	// Keep any other settings from before, if there are any; if there aren't, we
+	// get the zero value, which is exactly what we need.
+	settings, _ := config.Get()
+	settings.GameLocation = location
+	err = config.Write(settings)
 	if err != nil {
 		return wrap(err)
 	}
 	return nil
 }
 
+// moveStagedFiles moves each of files, given as slash-separated paths relative to
+// stagingdir, to the same path relative to dest, replacing any file already there.
+func moveStagedFiles(stagingdir, dest string, files []string) error {
+	for _, f := range files {
+		target := joinNoEscape(dest, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+			return err
+		}
+		if err := os.Rename(joinNoEscape(stagingdir, filepath.FromSlash(f)), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func guessGamePath() (string, bool) {
 	for _, p := range standardGamePaths {
 		exp := os.ExpandEnv(p)
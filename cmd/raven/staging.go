@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// These directories live inside the BepInEx directory, next to plugins; this keeps them
+// on the same filesystem, so that mods can be moved in and out of place by renaming them.
+const (
+	// New versions of mods are extracted here before being moved into place.
+	stagingDirName = "raven-staging"
+	// Previously installed versions of mods are moved here while the new versions are
+	// being moved into place, so that they can be restored if that fails.
+	backupDirName = "raven-backup"
+	// BepInEx itself is extracted here during setup before being moved into place.
+	setupStagingDirName = "raven-setup"
+)
+
+type swappedMod struct {
+	name        string
+	dest        string
+	backup      string
+	hadPrevious bool
+}
+
+// commitStagedMods moves each of the named mods from the staging directory into the
+// plugins directory, replacing any versions already there; mods that are currently
+// disabled stay disabled. If it fails to move any of them, it puts back all of the
+// previous versions.
+func commitStagedMods(gameLocation string, names []string) error {
+	plugins := pluginsDir(gameLocation)
+	stagingdir := filepath.Join(gameLocation, "BepInEx", stagingDirName)
+	backupdir := filepath.Join(gameLocation, "BepInEx", backupDirName)
+	if err := os.MkdirAll(plugins, 0750); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupdir, 0750); err != nil {
+		return err
+	}
+
+	swapped := make([]swappedMod, 0, len(names))
+	for _, name := range names {
+		dest := modDir(plugins, name)
+		rel, err := filepath.Rel(plugins, dest)
+		if err != nil {
+			return rollbackSwaps(gameLocation, swapped, err)
+		}
+		sm := swappedMod{name: name, dest: dest, backup: filepath.Join(backupdir, rel), hadPrevious: true}
+		if err := os.MkdirAll(filepath.Dir(sm.backup), 0750); err != nil {
+			return rollbackSwaps(gameLocation, swapped, err)
+		}
+		if err := os.Rename(dest, sm.backup); errors.Is(err, fs.ErrNotExist) {
+			sm.hadPrevious = false
+		} else if err != nil {
+			return rollbackSwaps(gameLocation, swapped, fmt.Errorf("move aside installed version of %s: %w", name, err))
+		}
+		swapped = append(swapped, sm)
+		if err := os.Rename(filepath.Join(stagingdir, name), dest); err != nil {
+			return rollbackSwaps(gameLocation, swapped, fmt.Errorf("move %s into place: %w", name, err))
+		}
+	}
+	if err := os.RemoveAll(backupdir); err != nil {
+		fmt.Println("warning: remove previous versions:", err)
+	}
+	return nil
+}
+
+// rollbackSwaps undoes the effects of a failed commitStagedMods call, and returns an
+// error describing the original failure cause along with any failures to restore
+// the previous state.
+func rollbackSwaps(gameLocation string, swapped []swappedMod, cause error) error {
+	backupdir := filepath.Join(gameLocation, "BepInEx", backupDirName)
+	errs := []error{cause}
+	for i := len(swapped) - 1; i >= 0; i-- {
+		sm := swapped[i]
+		if err := os.RemoveAll(sm.dest); err != nil {
+			errs = append(errs, fmt.Errorf("remove new version of %s: %w", sm.name, err))
+			continue
+		}
+		if !sm.hadPrevious {
+			continue
+		}
+		if err := os.Rename(sm.backup, sm.dest); err != nil {
+			errs = append(errs, fmt.Errorf("restore previous version of %s: %w", sm.name, err))
+		}
+	}
+	if len(errs) == 1 {
+		if err := os.RemoveAll(backupdir); err != nil {
+			fmt.Println("warning: remove previous versions:", err)
+		}
+		return fmt.Errorf("%w\nprevious versions were restored", cause)
+	}
+	return errors.Join(errs...)
+}
+
+// recoverInterruptedInstall restores any previous versions of mods that were left in the
+// backup directory by an installation that was interrupted before it could either finish
+// or roll back, and removes any leftover staged files.
+func recoverInterruptedInstall(gameLocation string) error {
+	wrap := func(err error) error {
+		return fmt.Errorf("recover from interrupted install: %w", err)
+	}
+	if err := os.RemoveAll(filepath.Join(gameLocation, "BepInEx", stagingDirName)); err != nil {
+		return wrap(err)
+	}
+	backupdir := filepath.Join(gameLocation, "BepInEx", backupDirName)
+	entries, err := os.ReadDir(backupdir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return wrap(err)
+	}
+	plugins := pluginsDir(gameLocation)
+	for _, e := range entries {
+		if !isDisabledDirName(e.Name()) {
+			if err := restoreBackup(e.Name(), filepath.Join(backupdir, e.Name()), filepath.Join(plugins, e.Name())); err != nil {
+				return wrap(err)
+			}
+			continue
+		}
+		disabledBackups, err := os.ReadDir(filepath.Join(backupdir, e.Name()))
+		if err != nil {
+			return wrap(err)
+		}
+		ddir := disabledDir(plugins)
+		for _, d := range disabledBackups {
+			if err := restoreBackup(d.Name(), filepath.Join(backupdir, e.Name(), d.Name()), filepath.Join(ddir, d.Name())); err != nil {
+				return wrap(err)
+			}
+		}
+	}
+	if err := os.RemoveAll(backupdir); err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+func restoreBackup(name, backup, dest string) error {
+	if _, err := os.Stat(dest); !errors.Is(err, fs.ErrNotExist) {
+		// The new version made it into place.
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0750); err != nil {
+		return err
+	}
+	if err := os.Rename(backup, dest); err != nil {
+		return err
+	}
+	fmt.Println("=> Restored previous version of", name)
+	return nil
+}
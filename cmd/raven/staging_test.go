@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommitStagedModsRollsBack(t *testing.T) {
+	game := t.TempDir()
+	plugins := pluginsDir(game)
+	staging := filepath.Join(game, "BepInEx", stagingDirName)
+	writeTestFile(t, filepath.Join(plugins, "A", "A.dll"), "old A")
+	writeTestFile(t, filepath.Join(plugins, "B", "B.dll"), "old B")
+	writeTestFile(t, filepath.Join(staging, "A", "A.dll"), "new A")
+	// B is missing from the staging directory, so moving it into place fails.
+
+	if err := commitStagedMods(game, []string{"A", "B"}); err == nil {
+		t.Fatal("commit succeeded with a missing staged mod")
+	}
+	for name, want := range map[string]string{"A": "old A", "B": "old B"} {
+		got, err := os.ReadFile(filepath.Join(plugins, name, name+".dll"))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRecoverInterruptedInstall(t *testing.T) {
+	game := t.TempDir()
+	backup := filepath.Join(game, "BepInEx", backupDirName)
+	writeTestFile(t, filepath.Join(backup, "A", "A.dll"), "old A")
+	writeTestFile(t, filepath.Join(backup, "B", "B.dll"), "old B")
+	writeTestFile(t, filepath.Join(pluginsDir(game), "B", "B.dll"), "new B")
+
+	if err := recoverInterruptedInstall(game); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"A": "old A", "B": "new B"} {
+		got, err := os.ReadFile(filepath.Join(pluginsDir(game), name, name+".dll"))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Errorf("backup directory still present: %v", err)
+	}
+}
+
+func TestMoveStagedFiles(t *testing.T) {
+	game := t.TempDir()
+	staging := filepath.Join(game, "BepInEx", setupStagingDirName)
+	writeTestFile(t, filepath.Join(pluginsDir(game), "A", "A.dll"), "A")
+	writeTestFile(t, filepath.Join(game, "BepInEx", "core", "BepInEx.dll"), "old core")
+	writeTestFile(t, filepath.Join(staging, "BepInEx", "core", "BepInEx.dll"), "new core")
+	writeTestFile(t, filepath.Join(staging, "winhttp.dll"), "proxy")
+
+	if err := moveStagedFiles(staging, game, []string{"BepInEx/core/BepInEx.dll", "winhttp.dll"}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"BepInEx/plugins/A/A.dll":  "A",
+		"BepInEx/core/BepInEx.dll": "new core",
+		"winhttp.dll":              "proxy",
+	} {
+		got, err := os.ReadFile(filepath.Join(game, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+type modStatus int
+
+const (
+	// The installed version has the same hash as the one on modlinks.
+	statusUpToDate modStatus = iota
+	// The installed version has a different hash from the one on modlinks.
+	statusOutdated
+	// The mod is on modlinks, but it wasn't installed by Raven, so we don't know which
+	// version it is.
+	statusUnknownProvenance
+	// The mod isn't on modlinks at all.
+	statusUnlisted
+)
+
+func (s modStatus) String() string {
+	switch s {
+	case statusUpToDate:
+		return "up to date"
+	case statusOutdated:
+		return "outdated"
+	case statusUnknownProvenance:
+		return "unknown provenance"
+	case statusUnlisted:
+		return "not on modlinks"
+	default:
+		return fmt.Sprintf("modStatus(%d)", int(s))
+	}
+}
+
+// checkMod compares the installed version of a mod, as recorded in man, against the
+// version available on modlinks.
+func checkMod(repo *modlinks.Repository, man manifest.Manifest, name string) (modlinks.Mod, modStatus) {
+	mod, err := repo.GetMod(name)
+	if err != nil {
+		return modlinks.Mod{}, statusUnlisted
+	}
+	im, ok := man.Mods[name]
+	switch {
+	case !ok:
+		return mod, statusUnknownProvenance
+	case strings.EqualFold(im.SHA256, mod.SHA256):
+		return mod, statusUpToDate
+	default:
+		return mod, statusOutdated
+	}
+}
+
+// resolveInstalledMods resolves each of args against the list of installed mods,
+// reporting any that fail to resolve. If args is empty, it returns all of the
+// installed mods.
+func resolveInstalledMods(installed []string, args []string) []string {
+	if len(args) == 0 {
+		return installed
+	}
+	resolved := make([]string, 0, len(args))
+	for _, arg := range args {
+		name, err := modlinks.ResolveModName(installed, arg)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		resolved = append(resolved, name)
+	}
+	return resolved
+}
+
+func update(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("update", flag.ContinueOnError)
+	var force bool
+	flags.BoolVar(&force, "force", false, "Install mods even if they conflict with each other")
+	var dryRun bool
+	flags.BoolVar(&dryRun, "dry-run", false, "Show what would be done, without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	settings, err := gameSettings()
+	if err != nil {
+		return err
+	}
+
+	cachedir, err := os.UserCacheDir()
+	if err != nil {
+		return fmt.Errorf("cache directory not available: %w", err)
+	}
+	if !dryRun {
+		release, err := acquireLocks(gameLock(settings.GameLocation), cacheLock(cachedir))
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	repo, err := loadModlinks(ctx, dryRun)
+	if err != nil {
+		return err
+	}
+	man, err := manifest.Get(settings.GameLocation)
+	if err != nil {
+		return err
+	}
+	installed, err := allInstalledMods(pluginsDir(settings.GameLocation))
+	if err != nil {
+		return err
+	}
+	targets := resolveInstalledMods(installed, args)
+
+	var listed, unlisted []string
+	requested := map[string]bool{}
+	for _, name := range targets {
+		_, status := checkMod(repo, man, name)
+		switch status {
+		case statusUnlisted:
+			unlisted = append(unlisted, name)
+			continue
+		case statusUnknownProvenance:
+			// The user put this mod here themselves, so it counts as explicitly installed
+			// once Raven takes over managing it.
+			requested[name] = true
+		}
+		listed = append(listed, name)
+	}
+
+	// Include dependencies too, since new versions may require newer versions of them,
+	// or even entirely new ones.
+	closure, err := repo.TransitiveClosure(listed)
+	if err != nil {
+		return err
+	}
+	var changed []modlinks.Mod
+	var current []string
+	for _, mod := range closure {
+		if _, status := checkMod(repo, man, mod.Name); status == statusUpToDate {
+			current = append(current, mod.Name)
+		} else {
+			changed = append(changed, mod)
+		}
+	}
+	if dryRun {
+		if err := printInstallPlan(ctx, settings.GameLocation, cachedir, man, changed); err != nil {
+			return err
+		}
+		printModSummary("Already up to date", current)
+		printModSummary("Not on modlinks", unlisted)
+		return nil
+	}
+	updated, err := installMods(ctx, settings.GameLocation, cachedir, man, changed, requested, force)
+	if err != nil {
+		return err
+	}
+	if err := manifest.Write(settings.GameLocation, man); err != nil {
+		return err
+	}
+
+	printModSummary("Updated", updated)
+	printModSummary("Already up to date", current)
+	printModSummary("Not on modlinks", unlisted)
+	return nil
+}
+
+func printModSummary(heading string, mods []string) {
+	if len(mods) == 0 {
+		return
+	}
+	sort.Strings(mods)
+	fmt.Printf("%s: %s\n", heading, strings.Join(mods, ", "))
+}
+
+func outdated(ctx context.Context, args []string) error {
+	settings, err := gameSettings()
+	if err != nil {
+		return err
+	}
+	repo, err := getModlinks(ctx)
+	if err != nil {
+		return err
+	}
+	man, err := manifest.Get(settings.GameLocation)
+	if err != nil {
+		return err
+	}
+	installed, err := allInstalledMods(pluginsDir(settings.GameLocation))
+	if err != nil {
+		return err
+	}
+	targets := resolveInstalledMods(installed, args)
+	sort.Strings(targets)
+	for _, name := range targets {
+		mod, status := checkMod(repo, man, name)
+		if status == statusOutdated {
+			fmt.Printf("%s: %s (installed %s, modlinks has %s)\n", name, status, shortHash(man.Mods[name].SHA256), shortHash(mod.SHA256))
+		} else {
+			fmt.Printf("%s: %s\n", name, status)
+		}
+	}
+	return nil
+}
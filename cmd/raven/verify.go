@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+func verify(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	var repair bool
+	flags.BoolVar(&repair, "repair", false, "Restore missing and modified files from the downloaded archives")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	settings, err := gameSettings()
+	if err != nil {
+		return err
+	}
+	cachedir, err := os.UserCacheDir()
+	if err != nil {
+		return fmt.Errorf("cache directory not available: %w", err)
+	}
+	if repair {
+		release, err := acquireLocks(gameLock(settings.GameLocation))
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	man, err := manifest.Get(settings.GameLocation)
+	if err != nil {
+		return err
+	}
+	modsdir := pluginsDir(settings.GameLocation)
+	installed, err := allInstalledMods(modsdir)
+	if err != nil {
+		return err
+	}
+	targets := resolveInstalledMods(installed, flags.Args())
+	sort.Strings(targets)
+
+	damaged := 0
+	unverifiable := 0
+	for _, name := range targets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ok, err := verifyMod(cachedir, modsdir, man, name, repair)
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			unverifiable++
+			continue
+		}
+		if !ok {
+			damaged++
+		}
+	}
+	var errs []error
+	if damaged > 0 {
+		errs = append(errs, fmt.Errorf("%d mods have missing or modified files; use verify -repair to restore them", damaged))
+	}
+	if unverifiable > 0 {
+		errs = append(errs, fmt.Errorf("%d mods could not be checked", unverifiable))
+	}
+	return errors.Join(errs...)
+}
+
+// verifyMod compares the installed files of a mod against those in its downloaded file,
+// reporting any differences. If repair is true, it restores any files that are missing or
+// have been modified. It returns whether the mod's files are, or have been restored to,
+// as they were installed.
+func verifyMod(cachedir, modsdir string, man manifest.Manifest, name string, repair bool) (bool, error) {
+	im, ok := man.Mods[name]
+	if !ok {
+		return false, errors.New("not installed by Raven, so there is nothing to compare it to")
+	}
+	if im.SHA256 == "" {
+		return false, errors.New("no hash was recorded when it was installed, so there is nothing to compare it to")
+	}
+	mod := modlinks.Mod{Name: name, Link: im.Link, SHA256: im.SHA256}
+	file := lookupCachedFile(cachedir, &mod)
+	if file == nil {
+		return false, fmt.Errorf("version %s is not in the download cache; reinstall it with raven install", shortHash(im.SHA256))
+	}
+	defer file.Close()
+	archived, err := archivedFiles(file, &mod)
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", shortHash(im.SHA256), err)
+	}
+
+	dir := modDir(modsdir, name)
+	expected := make(map[string]bool, len(archived))
+	intact := true
+	for _, af := range archived {
+		expected[af.name] = true
+		dest := joinNoEscape(dir, filepath.FromSlash(af.name))
+		same, err := af.matches(dest)
+		var problem string
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			problem = "missing"
+		case err != nil:
+			return false, err
+		case !same:
+			problem = "modified"
+		default:
+			continue
+		}
+		if !repair {
+			fmt.Printf("%s: %s %s\n", name, problem, af.name)
+			intact = false
+			continue
+		}
+		if err := af.restore(dest); err != nil {
+			fmt.Printf("%s: %s %s, and could not restore it: %v\n", name, problem, af.name, err)
+			intact = false
+			continue
+		}
+		fmt.Printf("%s: restored %s %s\n", name, problem, af.name)
+	}
+
+	present, err := dirFiles(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range present {
+		if !expected[f] {
+			fmt.Printf("%s: extra %s\n", name, f)
+		}
+	}
+	if intact {
+		fmt.Printf("%s: OK\n", name)
+	}
+	return intact, nil
+}
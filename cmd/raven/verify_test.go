@@ -0,0 +1,70 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dpinela/Raven/internal/manifest"
+	"github.com/dpinela/Raven/internal/modlinks"
+)
+
+// writeTestArchive stores a ZIP archive of a mod with the given files in cachedir's
+// download cache, and returns the mod's modlinks entry.
+func writeTestArchive(t *testing.T, cachedir, name string, files map[string]string) modlinks.Mod {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	mod := modlinks.Mod{Name: name, Link: "https://example.com/" + name + ".zip", SHA256: hex.EncodeToString(sum[:])}
+	writeTestFile(t, filepath.Join(downloadCacheDir(cachedir), cacheKey(&mod)), buf.String())
+	return mod
+}
+
+func TestVerifyModRepairs(t *testing.T) {
+	cachedir := t.TempDir()
+	mod := writeTestArchive(t, cachedir, "Plando", map[string]string{"Plando.dll": "plando", "sub/Plando.json": "{}"})
+	modsdir := pluginsDir(t.TempDir())
+	writeTestFile(t, filepath.Join(modsdir, "Plando", "Plando.dll"), "tampered")
+	man := manifest.Manifest{Mods: map[string]manifest.Mod{
+		"Plando": {Link: mod.Link, SHA256: mod.SHA256},
+	}}
+
+	intact, err := verifyMod(cachedir, modsdir, man, "Plando", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intact {
+		t.Fatal("verifyMod reported tampered mod as intact")
+	}
+	intact, err = verifyMod(cachedir, modsdir, man, "Plando", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !intact {
+		t.Fatal("verifyMod failed to repair mod")
+	}
+	for name, want := range map[string]string{"Plando.dll": "plando", "sub/Plando.json": "{}"} {
+		got, err := os.ReadFile(filepath.Join(modsdir, "Plando", filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s contains %q after repair, want %q", name, got, want)
+		}
+	}
+}
@@ -1,4 +1,5 @@
 #!/bin/sh
-GOOS=windows GOARCH=amd64 go build -ldflags=-w ./cmd/raven && \
+version=${VERSION:-$(git describe --tags --always --dirty)}
+GOOS=windows GOARCH=amd64 go build -ldflags="-w -X main.version=$version" ./cmd/raven && \
 zip raven-windows-amd64.zip raven.exe && \
-rm raven.exe
\ No newline at end of file
+rm raven.exe
@@ -9,6 +9,33 @@ import (
 
 type Settings struct {
 	GameLocation string
+	// CurrentProfile is the name of the profile that was last switched to, if any.
+	CurrentProfile string `toml:",omitempty"`
+	// ModlinksSource overrides where modlinks is fetched from; see modlinks.Get for the
+	// accepted values.
+	ModlinksSource string `toml:",omitempty"`
+	// DownloadLimit is the maximum number of mods to download at once; if zero, a default
+	// is used.
+	DownloadLimit int `toml:",omitempty"`
+	// RetryAttempts is the number of times to try each download before giving up; if zero,
+	// a default is used.
+	RetryAttempts int `toml:",omitempty"`
+	// Proxy is the URL of a proxy server to use for downloads. If empty, the proxy
+	// configured in the environment, if any, is used.
+	Proxy string `toml:",omitempty"`
+	// CacheLimitMB is the maximum size of the download cache, in megabytes; the least
+	// recently used downloads are removed to stay under it. Zero means no limit.
+	CacheLimitMB int `toml:",omitempty"`
+	// Preserve maps mod names to glob patterns matching files in their directories that
+	// are always kept when the mod is reinstalled. Patterns under the name "*" apply to
+	// every mod.
+	Preserve map[string][]string `toml:",omitempty"`
+}
+
+// PreservePatterns returns the patterns matching files that should be kept when the
+// named mod is reinstalled.
+func (s Settings) PreservePatterns(mod string) []string {
+	return append(append([]string(nil), s.Preserve["*"]...), s.Preserve[mod]...)
 }
 
 func Get() (Settings, error) {
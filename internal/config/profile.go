@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// A Profile is a named set of mods that can be switched to as a group.
+type Profile struct {
+	Mods []string
+}
+
+const profileExt = ".toml"
+
+func GetProfile(name string) (Profile, error) {
+	path, err := profilePath(name)
+	if err != nil {
+		return Profile{}, err
+	}
+	var p Profile
+	_, err = toml.DecodeFile(path, &p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Profile{}, fmt.Errorf("profile %q does not exist", name)
+	}
+	if err != nil {
+		return Profile{}, err
+	}
+	return p, nil
+}
+
+func WriteProfile(name string, p Profile) error {
+	path, err := profilePath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = toml.NewEncoder(f).Encode(p)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func DeleteProfile(name string) error {
+	path, err := profilePath(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("profile %q does not exist", name)
+	}
+	return err
+}
+
+// ProfileNames returns the names of all existing profiles.
+func ProfileNames() ([]string, error) {
+	dir, err := profilesDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == profileExt {
+			names = append(names, strings.TrimSuffix(e.Name(), profileExt))
+		}
+	}
+	return names, nil
+}
+
+func profilePath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid profile name %q", name)
+	}
+	dir, err := profilesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+profileExt), nil
+}
+
+func profilesDir() (string, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "profiles"), nil
+}
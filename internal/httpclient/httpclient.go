@@ -0,0 +1,228 @@
+// Package httpclient provides the HTTP client used for all of Raven's downloads, which
+// retries failed requests when it makes sense to.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy determines how many times and how often failed requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a request will be tried, including the
+	// first; values below 1 mean a single attempt.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry; it doubles for each subsequent one.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts, including any requested by the server.
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+type Client struct {
+	HTTP  *http.Client
+	Retry RetryPolicy
+	// UserAgent, if not empty, is sent with every request that doesn't set its own.
+	UserAgent string
+}
+
+// Default is a Client using the default HTTP client and retry policy.
+var Default = &Client{HTTP: http.DefaultClient, Retry: DefaultRetryPolicy}
+
+// Options configures a Client created by New.
+type Options struct {
+	UserAgent string
+	// ConnectTimeout limits how long establishing a connection, including the TLS
+	// handshake, may take.
+	ConnectTimeout time.Duration
+	// ReadTimeout limits how long to wait for the server to send anything, whether that's
+	// the response headers or the next piece of the body. Unlike an overall timeout, this
+	// doesn't limit how long large downloads can take, as long as they keep making progress.
+	ReadTimeout time.Duration
+	// Proxy is the URL of a proxy server to use for all requests. If empty, the proxy is
+	// taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy string
+	Retry RetryPolicy
+}
+
+const (
+	DefaultConnectTimeout = 30 * time.Second
+	DefaultReadTimeout    = 60 * time.Second
+)
+
+// New returns a Client configured according to opts. Zero timeouts are replaced with the
+// defaults.
+func New(opts Options) (*Client, error) {
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = DefaultConnectTimeout
+	}
+	if opts.ReadTimeout <= 0 {
+		opts.ReadTimeout = DefaultReadTimeout
+	}
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		u, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		proxy = http.ProxyURL(u)
+	}
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &readTimeoutConn{Conn: conn, timeout: opts.ReadTimeout}, nil
+		},
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.ReadTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &Client{
+		HTTP:      &http.Client{Transport: transport},
+		Retry:     opts.Retry,
+		UserAgent: opts.UserAgent,
+	}, nil
+}
+
+// readTimeoutConn fails any read that goes on for longer than timeout without
+// receiving anything.
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *readTimeoutConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+// Get is like Do, for a simple GET request.
+func (c *Client) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req, retrying it if it fails due to a network error or if the server responds
+// with a 5xx or 429 status. Any other response is returned as is.
+//
+// req must not have a body.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	attempts := max(c.Retry.MaxAttempts, 1)
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(req.Context(), c.Retry.delay(attempt, lastErr)); err != nil {
+				return nil, err
+			}
+		}
+		attemptReq := req.Clone(req.Context())
+		if c.UserAgent != "" && attemptReq.Header.Get("User-Agent") == "" {
+			attemptReq.Header.Set("User-Agent", c.UserAgent)
+		}
+		resp, err := c.HTTP.Do(attemptReq)
+		if err != nil {
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		if !isRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		lastErr = &statusError{status: resp.Status, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	if attempts == 1 {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("giving up after %d attempts: %w", attempts, lastErr)
+}
+
+func isRetryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+type statusError struct {
+	status     string
+	retryAfter time.Duration
+}
+
+func (err *statusError) Error() string {
+	return "response status was " + err.status
+}
+
+// delay returns how long to wait before the given retry attempt (counting from 1),
+// using exponential backoff with full jitter, unless the server asked for a
+// specific delay.
+func (p RetryPolicy) delay(attempt int, lastErr error) time.Duration {
+	var se *statusError
+	if errors.As(lastErr, &se) && se.retryAfter > 0 {
+		return min(se.retryAfter, p.MaxDelay)
+	}
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// parseRetryAfter interprets the value of a Retry-After header, which may be either
+// a number of seconds or a date. It returns 0 if the header is absent or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// Wait waits as long as the retry policy says to before the given retry attempt
+// (counting from 1), for callers that retry failures that Do can't see, such as a
+// response body being cut off. It returns early with an error if ctx is cancelled.
+func (c *Client) Wait(ctx context.Context, attempt int) error {
+	return sleep(ctx, c.Retry.delay(attempt, nil))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
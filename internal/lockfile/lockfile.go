@@ -0,0 +1,163 @@
+// Package lockfile implements advisory locks between processes, using files that exist
+// only while the lock is held.
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// staleAge is how old a lock held by a process on another machine, or a lock file we can't
+// make sense of, has to be before we assume its owner is gone.
+const staleAge = 24 * time.Hour
+
+// A Lock is a held lock.
+type Lock struct {
+	path string
+}
+
+// LockedError is returned by Acquire if the lock is held by another process.
+type LockedError struct {
+	Path     string
+	PID      int
+	Hostname string
+	Since    time.Time
+}
+
+func (err *LockedError) Error() string {
+	return fmt.Sprintf("another Raven is running (process %d on %s, since %s); if that's not the case, delete %s",
+		err.PID, err.Hostname, err.Since.Local().Format(time.DateTime), err.Path)
+}
+
+// Acquire takes the lock represented by the file at path, failing with a *LockedError if
+// another process holds it. Locks left behind by processes that no longer exist are
+// taken over.
+func Acquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	l, err := tryAcquire(path)
+	if !errors.Is(err, fs.ErrExist) {
+		return l, err
+	}
+	owner, stale := readOwner(path)
+	if !stale {
+		return nil, owner
+	}
+	if err := removeStale(path, owner); err != nil {
+		return nil, err
+	}
+	l, err = tryAcquire(path)
+	if errors.Is(err, fs.ErrExist) {
+		// Someone else took over the stale lock before we could.
+		owner, _ := readOwner(path)
+		return nil, owner
+	}
+	return l, err
+}
+
+// beforeRemoveStale, if not nil, is called after a lock has been found to be stale and
+// before it is removed; tests use it to simulate other processes racing with us.
+var beforeRemoveStale func()
+
+// removeStale removes the lock at path, which was found to be held by stale, a process
+// that has gone away. Several processes may find the same stale lock at once; to make sure
+// that none of them removes a lock that another has just taken over in its place, only one
+// at a time may remove it, guarded by a second lock file, and it checks again that the
+// lock still belongs to stale before doing so.
+func removeStale(path string, stale *LockedError) error {
+	guardPath := path + ".takeover"
+	guard, err := tryAcquire(guardPath)
+	if errors.Is(err, fs.ErrExist) {
+		// Another process is taking the lock over. A guard is only held for a moment, so
+		// if it's been there for long, whoever held it is gone; clear it so that we don't
+		// get stuck forever, but still let this attempt fail.
+		if info, err := os.Stat(guardPath); err == nil && time.Since(info.ModTime()) > time.Minute {
+			os.Remove(guardPath)
+		}
+		owner, _ := readOwner(path)
+		return owner
+	}
+	if err != nil {
+		return err
+	}
+	defer guard.Release()
+
+	if beforeRemoveStale != nil {
+		beforeRemoveStale()
+	}
+	current, stillStale := readOwner(path)
+	if !stillStale || !current.sameOwner(stale) {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			// It was released in the meantime.
+			return nil
+		}
+		return current
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (err *LockedError) sameOwner(other *LockedError) bool {
+	return err.PID == other.PID && err.Hostname == other.Hostname && err.Since.Equal(other.Since)
+}
+
+func tryAcquire(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	_, err = fmt.Fprintf(f, "%d\n%s\n%s\n", os.Getpid(), hostname, time.Now().UTC().Format(time.RFC3339))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return &Lock{path: path}, nil
+}
+
+// readOwner describes the holder of the lock at path, and reports whether it seems to
+// have gone away without releasing it.
+func readOwner(path string) (*LockedError, bool) {
+	owner := &LockedError{Path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		// The lock was just released; try again.
+		return owner, errors.Is(err, fs.ErrNotExist)
+	}
+	owner.Since = info.ModTime()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return owner, false
+	}
+	fields := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(fields) < 2 {
+		// The owner might still be in the middle of writing the file.
+		return owner, time.Since(owner.Since) > time.Minute
+	}
+	owner.PID, err = strconv.Atoi(fields[0])
+	if err != nil {
+		return owner, time.Since(owner.Since) > staleAge
+	}
+	owner.Hostname = fields[1]
+	if hostname, _ := os.Hostname(); hostname == owner.Hostname {
+		return owner, owner.PID <= 0 || !processExists(owner.PID)
+	}
+	return owner, time.Since(owner.Since) > staleAge
+}
+
+// Release gives up the lock.
+func (l *Lock) Release() error {
+	return os.Remove(l.path)
+}
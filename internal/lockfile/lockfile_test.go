@@ -0,0 +1,89 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireExcludesOthers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	l, err := Acquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Acquire(path)
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("second Acquire returned %v, want a *LockedError", err)
+	}
+	if locked.PID != os.Getpid() {
+		t.Errorf("lock owner is process %d, want %d", locked.PID, os.Getpid())
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+	l.Release()
+}
+
+func TestAcquireTakesOverStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	hostname, _ := os.Hostname()
+	// A process can't have a negative ID, so this one can't be running.
+	content := fmt.Sprintf("-2\n%s\n%s\n", hostname, time.Now().UTC().Format(time.RFC3339))
+	if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire over stale lock: %v", err)
+	}
+	l.Release()
+}
+
+func TestAcquireLeavesFreshLockAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	hostname, _ := os.Hostname()
+	stale := fmt.Sprintf("-2\n%s\n%s\n", hostname, time.Now().UTC().Format(time.RFC3339))
+	if err := os.WriteFile(path, []byte(stale), 0640); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate another process taking over the stale lock after we found it stale, but
+	// before we could remove it.
+	fresh := fmt.Sprintf("%d\n%s\n%s\n", os.Getpid(), hostname, time.Now().UTC().Format(time.RFC3339))
+	beforeRemoveStale = func() {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(fresh), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() { beforeRemoveStale = nil }()
+
+	l, err := Acquire(path)
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		if l != nil {
+			l.Release()
+		}
+		t.Fatalf("Acquire returned %v, want a *LockedError", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != fresh {
+		t.Errorf("lock file contains %q after failed Acquire, want %q", content, fresh)
+	}
+	if _, err := os.Stat(path + ".takeover"); err == nil {
+		t.Error("takeover guard was left behind")
+	}
+}
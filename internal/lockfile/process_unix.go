@@ -0,0 +1,18 @@
+//go:build !windows
+
+package lockfile
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
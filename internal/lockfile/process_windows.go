@@ -0,0 +1,13 @@
+package lockfile
+
+import "os"
+
+func processExists(pid int) bool {
+	// On Windows, FindProcess fails if there is no process with that ID.
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
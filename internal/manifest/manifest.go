@@ -0,0 +1,93 @@
+// Package manifest keeps track of which mods Raven has installed into a game.
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const fileName = "raven-manifest.toml"
+
+type Manifest struct {
+	Mods map[string]Mod
+}
+
+// Mod describes an installed mod.
+type Mod struct {
+	Link        string
+	SHA256      string
+	InstalledAt time.Time
+	// Files lists the files extracted for the mod, as slash-separated paths relative to its
+	// installation directory.
+	Files []string
+	// Explicit is true if the user asked for the mod to be installed, as opposed to it being
+	// installed only to satisfy another mod's dependencies.
+	Explicit bool
+}
+
+// Get reads the manifest for the game installed at gameLocation. If there is no manifest,
+// it returns an empty one.
+func Get(gameLocation string) (Manifest, error) {
+	m := Manifest{Mods: map[string]Mod{}}
+	_, err := toml.DecodeFile(filePath(gameLocation), &m)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Manifest{Mods: map[string]Mod{}}, nil
+	}
+	if err != nil {
+		return Manifest{}, fmt.Errorf("read install manifest: %w", err)
+	}
+	if m.Mods == nil {
+		m.Mods = map[string]Mod{}
+	}
+	return m, nil
+}
+
+func Write(gameLocation string, m Manifest) error {
+	wrap := func(err error) error {
+		return fmt.Errorf("write install manifest: %w", err)
+	}
+	path := filePath(gameLocation)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return wrap(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return wrap(err)
+	}
+	defer f.Close()
+	err = toml.NewEncoder(f).Encode(m)
+	if err != nil {
+		return wrap(err)
+	}
+	if err := f.Close(); err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// Prune removes the entries for any mods not included in installed, and reports whether
+// it removed any.
+func (m Manifest) Prune(installed []string) bool {
+	present := make(map[string]bool, len(installed))
+	for _, name := range installed {
+		present[name] = true
+	}
+	changed := false
+	for name := range m.Mods {
+		if !present[name] {
+			delete(m.Mods, name)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func filePath(gameLocation string) string {
+	return filepath.Join(gameLocation, "BepInEx", fileName)
+}
@@ -0,0 +1,38 @@
+package manifest
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	m, err := Get(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Mods) != 0 {
+		t.Fatalf("got %d mods from missing manifest, want 0", len(m.Mods))
+	}
+	want := Mod{
+		Link:        "https://example.com/Plando.zip",
+		SHA256:      "0123abcd",
+		InstalledAt: time.Date(2024, 4, 8, 12, 0, 0, 0, time.UTC),
+		Files:       []string{"Plando.dll", "Plando.pdb"},
+		Explicit:    true,
+	}
+	m.Mods["Plando"] = want
+	if err := Write(dir, m); err != nil {
+		t.Fatal(err)
+	}
+	m, err = Get(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.Mods["Plando"]
+	if got.Link != want.Link || got.SHA256 != want.SHA256 || !got.InstalledAt.Equal(want.InstalledAt) ||
+		!slices.Equal(got.Files, want.Files) || got.Explicit != want.Explicit {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package modlinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dpinela/Raven/internal/httpclient"
+)
+
+const (
+	cachedArchiveName  = "modlinks.zip"
+	cachedMetadataName = "modlinks.toml"
+)
+
+// cacheMetadata records what is needed to revalidate a cached archive.
+type cacheMetadata struct {
+	URL          string
+	ETag         string `toml:",omitempty"`
+	LastModified string `toml:",omitempty"`
+}
+
+// download fetches the archive at url using client. If cachedir is not empty, it reuses the copy of
+// the archive stored there if the server reports that it has not changed, and otherwise
+// stores the new one there, unless readOnly is true.
+func download(ctx context.Context, client *httpclient.Client, url, cachedir string, readOnly bool) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	var cached []byte
+	if cachedir != "" {
+		var meta cacheMetadata
+		cached, meta = readCache(cachedir)
+		if cached != nil && meta.URL == url {
+			if meta.ETag != "" {
+				req.Header.Set("If-None-Match", meta.ETag)
+			}
+			if meta.LastModified != "" {
+				req.Header.Set("If-Modified-Since", meta.LastModified)
+			}
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("got HTTP status %s, expected 200 OK", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if cachedir != "" && !readOnly {
+		// The cache is only an optimization; failing to update it is not a problem.
+		_ = writeCache(cachedir, body, cacheMetadata{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		})
+	}
+	return body, nil
+}
+
+// readCache returns the cached archive and its metadata, or a nil archive if there is no
+// usable one.
+func readCache(cachedir string) ([]byte, cacheMetadata) {
+	var meta cacheMetadata
+	if _, err := toml.DecodeFile(filepath.Join(cachedir, cachedMetadataName), &meta); err != nil {
+		return nil, cacheMetadata{}
+	}
+	body, err := os.ReadFile(filepath.Join(cachedir, cachedArchiveName))
+	if err != nil {
+		return nil, cacheMetadata{}
+	}
+	return body, meta
+}
+
+// errNoCachedArchive is returned when working offline and there is no cached archive to use.
+var errNoCachedArchive = errors.New("no cached copy available")
+
+// readCachedArchive returns the cached copy of the archive at url, without checking whether
+// it is up to date.
+func readCachedArchive(url, cachedir string) ([]byte, error) {
+	if cachedir == "" {
+		return nil, errNoCachedArchive
+	}
+	body, meta := readCache(cachedir)
+	if body == nil || meta.URL != url {
+		return nil, errNoCachedArchive
+	}
+	return body, nil
+}
+
+func writeCache(cachedir string, body []byte, meta cacheMetadata) error {
+	if err := os.MkdirAll(cachedir, 0750); err != nil {
+		return err
+	}
+	// Remove the old metadata first, so that if we fail partway through, we don't end up
+	// with metadata that describes the wrong archive.
+	metaPath := filepath.Join(cachedir, cachedMetadataName)
+	if err := os.Remove(metaPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(cachedir, cachedArchiveName), body); err != nil {
+		return err
+	}
+	f, err := os.Create(metaPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := toml.NewEncoder(f).Encode(meta); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeFileAtomic writes data to the named file via a temporary file, so that the file
+// is never seen partially written.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
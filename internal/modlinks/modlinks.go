@@ -3,18 +3,21 @@ package modlinks
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"io/fs"
-	"net/http"
+	"os"
 	"path"
 	"regexp"
 	"strings"
 
 	"github.com/BurntSushi/toml"
+	"github.com/dpinela/Raven/internal/httpclient"
 )
 
-const modlinksURL = "https://github.com/dd-modding/modlinks/archive/refs/heads/main.zip"
+// DefaultSource is where modlinks is fetched from if no other source is configured.
+const DefaultSource = "https://github.com/dd-modding/modlinks/archive/refs/heads/main.zip"
 
 type Mod struct {
 	Name         string
@@ -27,31 +30,146 @@ type Mod struct {
 }
 
 type Repository struct {
-	arch *zip.Reader
+	// fsys is rooted at the top of the modlinks tree, where the base and mods
+	// directories are.
+	fsys fs.FS
+	// fetchErr is the error that prevented downloading modlinks, if a cached
+	// copy was used instead.
+	fetchErr error
 }
 
-func Get() (*Repository, error) {
+// Options controls where and how Get loads modlinks from.
+type Options struct {
+	// Source may be the URL of a ZIP archive, the path to a local ZIP archive, or the path
+	// to a local directory containing a copy of modlinks. If empty, DefaultSource is used.
+	Source string
+	// CacheDir, if not empty, is a directory in which archives downloaded from URL sources
+	// are kept, so that they need only be downloaded again when they change. If downloading
+	// fails, the cached archive is used instead.
+	CacheDir string
+	// Offline makes Get use the cached archive for URL sources without trying to download
+	// it first.
+	Offline bool
+	// ReadOnly makes Get use the archive cached in CacheDir, if there is one, without
+	// storing anything there.
+	ReadOnly bool
+	// Client is used to download archives from URL sources; if nil, httpclient.Default
+	// is used.
+	Client *httpclient.Client
+}
+
+// Get loads modlinks as specified by opts.
+func Get(ctx context.Context, opts Options) (*Repository, error) {
+	source := opts.Source
+	if source == "" {
+		source = DefaultSource
+	}
 	wrap := func(err error) error {
-		return fmt.Errorf("get modlinks: %w", err)
+		return fmt.Errorf("get modlinks from %s: %w", source, err)
 	}
 
-	resp, err := http.Get(modlinksURL)
+	if isURL(source) {
+		if opts.Offline {
+			body, err := readCachedArchive(source, opts.CacheDir)
+			if err != nil {
+				return nil, wrap(err)
+			}
+			return fromZIP(body, wrap)
+		}
+		client := opts.Client
+		if client == nil {
+			client = httpclient.Default
+		}
+		body, err := download(ctx, client, source, opts.CacheDir, opts.ReadOnly)
+		if err == nil {
+			return fromZIP(body, wrap)
+		}
+		if ctx.Err() != nil {
+			// Don't fall back to the cache if the user asked us to stop.
+			return nil, wrap(err)
+		}
+		body, cacheErr := readCachedArchive(source, opts.CacheDir)
+		if cacheErr != nil {
+			return nil, wrap(err)
+		}
+		r, zipErr := fromZIP(body, wrap)
+		if zipErr != nil {
+			return nil, wrap(err)
+		}
+		r.fetchErr = wrap(err)
+		return r, nil
+	}
+	info, err := os.Stat(source)
 	if err != nil {
 		return nil, wrap(err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("get modlinks: got HTTP status %s, expected 200 OK", resp.Status)
+	if info.IsDir() {
+		r, err := FromFS(os.DirFS(source))
+		if err != nil {
+			return nil, wrap(err)
+		}
+		return r, nil
 	}
-	body, err := io.ReadAll(resp.Body)
+	body, err := os.ReadFile(source)
 	if err != nil {
 		return nil, wrap(err)
 	}
+	return fromZIP(body, wrap)
+}
+
+// FetchError returns the error that prevented modlinks from being downloaded, if
+// a previously cached copy was loaded instead, or nil otherwise.
+func (r *Repository) FetchError() error {
+	return r.fetchErr
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+func fromZIP(body []byte, wrap func(error) error) (*Repository, error) {
 	z, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
 	if err != nil {
 		return nil, wrap(err)
 	}
-	return &Repository{z}, nil
+	r, err := FromFS(z)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return r, nil
+}
+
+// FromFS returns a Repository backed by fsys. The modlinks tree may be either at the root
+// of fsys, or inside a single top-level directory, as in the archives GitHub generates.
+func FromFS(fsys fs.FS) (*Repository, error) {
+	if isModlinksRoot(fsys, ".") {
+		return &Repository{fsys: fsys}, nil
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() && isModlinksRoot(fsys, e.Name()) {
+			sub, err := fs.Sub(fsys, e.Name())
+			if err != nil {
+				return nil, err
+			}
+			return &Repository{fsys: sub}, nil
+		}
+	}
+	return nil, errNotModlinks
+}
+
+var errNotModlinks = errors.New("no mods or base directory found")
+
+func isModlinksRoot(fsys fs.FS, dir string) bool {
+	for _, section := range []string{"mods", "base"} {
+		if info, err := fs.Stat(fsys, path.Join(dir, section)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *Repository) GetBase(thingName string) (Mod, error) {
@@ -68,7 +186,16 @@ func (r *Repository) ResolveModName(modName string) (string, error) {
 }
 
 func (r *Repository) ModNames() []string {
-	modFiles, _ := fs.Glob(r.arch, "modlinks-main/mods/*.toml")
+	return r.names("mods")
+}
+
+// BaseNames returns the names of the base components, such as BepInEx.
+func (r *Repository) BaseNames() []string {
+	return r.names("base")
+}
+
+func (r *Repository) names(section string) []string {
+	modFiles, _ := fs.Glob(r.fsys, section+"/*.toml")
 	names := make([]string, len(modFiles))
 	for i, mf := range modFiles {
 		b := path.Base(mf)
@@ -78,10 +205,19 @@ func (r *Repository) ModNames() []string {
 }
 
 func (r *Repository) TransitiveClosure(leaves []string) ([]Mod, error) {
+	result, _, err := r.TransitiveClosureWithParents(leaves)
+	return result, err
+}
+
+// TransitiveClosureWithParents is like TransitiveClosure, but also returns a map from the
+// name of each mod in the closure to the names of the mods in it that list it as a
+// dependency.
+func (r *Repository) TransitiveClosureWithParents(leaves []string) ([]Mod, map[string][]string, error) {
 	resultSet := map[string]Mod{}
 	missingModSet := map[string]error{}
+	parents := map[string][]string{}
 	for _, leaf := range leaves {
-		r.transitiveClosure(resultSet, missingModSet, leaf)
+		r.transitiveClosure(resultSet, missingModSet, parents, leaf)
 	}
 	result := make([]Mod, 0, len(resultSet))
 	for _, mod := range resultSet {
@@ -95,10 +231,10 @@ func (r *Repository) TransitiveClosure(leaves []string) ([]Mod, error) {
 	if len(missing) > 0 {
 		err = missing
 	}
-	return result, err
+	return result, parents, err
 }
 
-func (r *Repository) transitiveClosure(resultSet map[string]Mod, missingMods map[string]error, name string) {
+func (r *Repository) transitiveClosure(resultSet map[string]Mod, missingMods map[string]error, parents map[string][]string, name string) {
 	if _, ok := resultSet[name]; ok {
 		return
 	}
@@ -112,7 +248,8 @@ func (r *Repository) transitiveClosure(resultSet map[string]Mod, missingMods map
 	}
 	resultSet[name] = m
 	for _, dep := range m.Dependencies {
-		r.transitiveClosure(resultSet, missingMods, dep)
+		parents[dep] = append(parents[dep], name)
+		r.transitiveClosure(resultSet, missingMods, parents, dep)
 	}
 }
 
@@ -124,7 +261,7 @@ func (err missingModsError) Error() string {
 
 func (r *Repository) get(section, modName string) (Mod, error) {
 	var m Mod
-	_, err := toml.DecodeFS(r.arch, path.Join("modlinks-main", section, modName+".toml"), &m)
+	_, err := toml.DecodeFS(r.fsys, path.Join(section, modName+".toml"), &m)
 	if err != nil {
 		return Mod{}, fmt.Errorf("get mod %q: %w", modName, err)
 	}
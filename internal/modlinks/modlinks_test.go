@@ -0,0 +1,95 @@
+package modlinks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dpinela/Raven/internal/httpclient"
+)
+
+func modFile(deps string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte("Dependencies = [" + deps + "]\n")}
+}
+
+func TestFromFSDetectsPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "modlinks-main/", "private-fork-testing/"} {
+		fsys := fstest.MapFS{
+			prefix + "mods/Plando.toml":  modFile(""),
+			prefix + "mods/Randemo.toml": modFile(`"Plando"`),
+			prefix + "base/BepInEx.toml": modFile(""),
+			"README.md":                  &fstest.MapFile{},
+		}
+		r, err := FromFS(fsys)
+		if err != nil {
+			t.Errorf("prefix %q: %v", prefix, err)
+			continue
+		}
+		names := r.ModNames()
+		sort.Strings(names)
+		if want := []string{"Plando", "Randemo"}; !slices.Equal(names, want) {
+			t.Errorf("prefix %q: got mods %q, want %q", prefix, names, want)
+		}
+	}
+}
+
+func TestFromFSRejectsOtherTrees(t *testing.T) {
+	fsys := fstest.MapFS{"something/else.toml": &fstest.MapFile{}}
+	if _, err := FromFS(fsys); err == nil {
+		t.Error("got no error for a tree without mods")
+	}
+}
+
+func TestDownloadRevalidatesCache(t *testing.T) {
+	const etag = `"v1"`
+	var hits, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte("archive contents"))
+	}))
+	defer srv.Close()
+
+	cachedir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		body, err := download(context.Background(), httpclient.Default, srv.URL, cachedir, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "archive contents" {
+			t.Errorf("request %d: got body %q", i, body)
+		}
+	}
+	if hits != 2 || notModified != 1 {
+		t.Errorf("got %d requests, %d not modified; want 2 and 1", hits, notModified)
+	}
+}
+
+func TestDownloadReadOnlyLeavesCacheAlone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("archive contents"))
+	}))
+	defer srv.Close()
+
+	cachedir := t.TempDir()
+	if _, err := download(context.Background(), httpclient.Default, srv.URL, cachedir, true); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(cachedir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("read-only download wrote %d files to the cache", len(entries))
+	}
+}